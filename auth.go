@@ -1,16 +1,20 @@
 package main
 
 import (
+	"encoding/base64"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
+	"io"
 	"os"
-	"path/filepath"
+	"strings"
 	"time"
+
+	"github.com/mattn/go-isatty"
 )
 
-func SaveJWT() error {
-	jwt, err := GetInput("Enter your Pinata JWT")
+func SaveJWT(jwt string, settings Profile) error {
+	jwt, err := readJWT(jwt)
 	if err != nil {
 		return err
 	}
@@ -19,72 +23,225 @@ func SaveJWT() error {
 		return errors.New("JWT cannot be empty")
 	}
 
-	home, err := os.UserHomeDir()
+	err = updateProfile(func(profile *Profile) {
+		profile.JWT = jwt
+		if settings.Group != "" {
+			profile.Group = settings.Group
+		}
+		if settings.APIHost != "" {
+			profile.APIHost = settings.APIHost
+		}
+		if settings.UploadsHost != "" {
+			profile.UploadsHost = settings.UploadsHost
+		}
+	})
 	if err != nil {
 		return err
 	}
-	p := filepath.Join(home, ".pinata-files-cli")
-	err = os.WriteFile(p, []byte(jwt), 0600)
+	err = testAuthentication(jwt)
 	if err != nil {
 		return err
 	}
-	host := GetHost()
-	url := fmt.Sprintf("https://%s/data/testAuthentication", host)
-	req, err := http.NewRequest("GET", url, nil)
+
+	fmt.Println("Authentication Successful!")
+	gateway := settings.Gateway
+	if gateway == "" && !isInteractive() {
+		fmt.Fprintln(os.Stderr, "Skipping gateway selection since this is not a terminal, set one with the 'gateways set' command or --gateway")
+		return nil
+	}
+	err = SetGateway(gateway)
 	if err != nil {
 		return err
 	}
 
-	req.Header.Set("Authorization", "Bearer "+jwt)
+	return nil
+}
 
-	client := &http.Client{
-		Timeout: time.Duration(time.Second * 3),
+// readJWT finds the JWT to save from the argument, "-" for stdin, the
+// PINATA_JWT environment variable or piped stdin before prompting for it
+func readJWT(arg string) (string, error) {
+	if arg != "" && arg != "-" {
+		return strings.TrimSpace(arg), nil
 	}
-	resp, err := client.Do(req)
-	if err != nil {
-		return err
+	if jwt := os.Getenv("PINATA_JWT"); jwt != "" && arg == "" {
+		return strings.TrimSpace(jwt), nil
 	}
+	if arg == "-" || !isatty.IsTerminal(os.Stdin.Fd()) && !isatty.IsCygwinTerminal(os.Stdin.Fd()) {
+		input, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return "", errors.Join(err, errors.New("failed to read JWT from stdin"))
+		}
+		return strings.TrimSpace(string(input)), nil
+	}
+	return GetInput("Enter your Pinata JWT")
+}
 
-	defer resp.Body.Close()
-	status := resp.StatusCode
-	if status != 200 {
-		return errors.New("Authentication failed, make sure you are using the Pinata JWT")
+func isInteractive() bool {
+	for _, f := range []*os.File{os.Stdin, os.Stdout} {
+		if !isatty.IsTerminal(f.Fd()) && !isatty.IsCygwinTerminal(f.Fd()) {
+			return false
+		}
 	}
+	return true
+}
 
-	fmt.Println("Authentication Successful!")
-	err = SetGateway("")
+func testAuthentication(jwt string) error {
+	client := newClientWithToken(jwt)
+	client.HTTPClient.Timeout = time.Duration(time.Second * 3)
+
+	err := client.Get("/data/testAuthentication", nil, nil)
 	if err != nil {
-		return err
+		return fmt.Errorf("Authentication failed, make sure you are using the Pinata JWT: %w", err)
 	}
-
 	return nil
 }
 
 func findToken() ([]byte, error) {
-	homeDir, err := os.UserHomeDir()
+	return findTokenFor("")
+}
+
+// findTokenFor finds the JWT of the named profile, or of the active profile
+// when profile is empty. PINATA_JWT takes precedence over both.
+func findTokenFor(profile string) ([]byte, error) {
+	if jwt := os.Getenv("PINATA_JWT"); jwt != "" {
+		return []byte(strings.TrimSpace(jwt)), nil
+	}
+	config, err := loadConfig()
 	if err != nil {
 		return nil, err
 	}
-	dotFilePath := filepath.Join(homeDir, ".pinata-files-cli")
-	JWT, err := os.ReadFile(dotFilePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, errors.New("JWT not found. Please authorize first using the 'auth' command")
-		} else {
-			return nil, err
-		}
+	if profile == "" {
+		profile = config.ActiveProfileName()
+	}
+	jwt := config.Profile(profile).JWT
+	if jwt == "" {
+		return nil, fmt.Errorf("JWT not found for profile %q. Please authorize first using the 'auth' command", profile)
 	}
-	return JWT, err
+	return []byte(jwt), nil
 }
 
 func GetHost() string {
-	return GetEnv("PINATA_HOST", "api.pinata.cloud")
+	return settingString("api_host")
+}
+
+func GetUploadsHost() string {
+	return settingString("uploads_host")
+}
+
+func GetScheme() string {
+	return settingString("scheme")
+}
+
+// hostURL turns a host from the environment into a base URL, keeping any
+// scheme that was already included such as http://localhost:8080
+func hostURL(host string) string {
+	if strings.Contains(host, "://") {
+		return strings.TrimSuffix(host, "/")
+	}
+	return fmt.Sprintf("%s://%s", GetScheme(), strings.TrimSuffix(host, "/"))
+}
+
+type jwtClaims struct {
+	UserInformation struct {
+		Id    string `json:"id"`
+		Email string `json:"email"`
+	} `json:"userInformation"`
+	AuthenticationType string      `json:"authenticationType"`
+	ScopedKeyKey       string      `json:"scopedKeyKey"`
+	Scopes             interface{} `json:"scopes"`
+	IssuedAt           int64       `json:"iat"`
+	ExpiresAt          int64       `json:"exp"`
 }
 
-func GetEnv(key, defaultValue string) string {
-	value := os.Getenv(key)
-	if len(value) == 0 {
-		return defaultValue
+// decodeJWT reads the claims of a JWT without verifying its signature, which
+// is left to the API
+func decodeJWT(jwt string) (jwtClaims, error) {
+	parts := strings.Split(jwt, ".")
+	if len(parts) != 3 {
+		return jwtClaims{}, errors.New("JWT is malformed")
 	}
-	return value
+	payload, err := base64.RawURLEncoding.DecodeString(strings.TrimRight(parts[1], "="))
+	if err != nil {
+		return jwtClaims{}, errors.Join(err, errors.New("failed to decode JWT claims"))
+	}
+	var claims jwtClaims
+	err = json.Unmarshal(payload, &claims)
+	if err != nil {
+		return jwtClaims{}, errors.Join(err, errors.New("failed to parse JWT claims"))
+	}
+	return claims, nil
+}
+
+func formatUnix(seconds int64) string {
+	if seconds == 0 {
+		return ""
+	}
+	return time.Unix(seconds, 0).UTC().Format(time.RFC3339)
+}
+
+func AuthStatus() (AuthStatusResponse, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return AuthStatusResponse{}, err
+	}
+	jwt, source := resolveSetting("jwt")
+	if jwt == "" {
+		return AuthStatusResponse{}, fmt.Errorf("JWT not found for profile %q. Please authorize first using the 'auth' command", config.ActiveProfileName())
+	}
+
+	status := AuthStatusResponse{
+		Profile: config.ActiveProfileName(),
+		Source:  source,
+		APIHost: GetHost(),
+		Gateway: settingString("gateway"),
+	}
+
+	claims, err := decodeJWT(jwt)
+	if err == nil {
+		status.UserId = claims.UserInformation.Id
+		status.Email = claims.UserInformation.Email
+		status.KeyId = claims.ScopedKeyKey
+		status.KeyType = claims.AuthenticationType
+		status.Scopes = claims.Scopes
+		status.IssuedAt = formatUnix(claims.IssuedAt)
+		status.ExpiresAt = formatUnix(claims.ExpiresAt)
+		status.Expired = claims.ExpiresAt != 0 && time.Now().Unix() > claims.ExpiresAt
+	}
+
+	authErr := testAuthentication(jwt)
+	status.Authenticated = authErr == nil
+	if authErr != nil {
+		status.Error = authErr.Error()
+	}
+
+	err = render(status, status)
+	if err != nil {
+		return AuthStatusResponse{}, err
+	}
+
+	return status, authErr
+}
+
+func Logout() error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	name := config.ActiveProfileName()
+	profile, ok := config.Profiles[name]
+	if !ok || profile.JWT == "" {
+		return fmt.Errorf("profile %q is not logged in", name)
+	}
+
+	profile.JWT = ""
+	err = saveConfig(config)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Logged out of profile %s\n", name)
+	if os.Getenv("PINATA_JWT") != "" {
+		fmt.Fprintln(os.Stderr, "PINATA_JWT is still set and will be used until it is unset")
+	}
+	return nil
 }
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+type UploadResult struct {
+	Path  string `json:"path"`
+	Id    string `json:"id"`
+	Name  string `json:"name"`
+	Cid   string `json:"cid"`
+	Size  int    `json:"size"`
+	Error string `json:"error,omitempty"`
+
+	response UploadResponse
+}
+
+// expandPaths expands the glob patterns in paths, for shells that don't and
+// for patterns that were quoted. Other paths are kept as they are.
+func expandPaths(paths []string) ([]string, error) {
+	var expanded []string
+	for _, p := range paths {
+		if !strings.ContainsAny(p, "*?[") {
+			expanded = append(expanded, p)
+			continue
+		}
+		matches, err := filepath.Glob(p)
+		if err != nil {
+			return nil, fmt.Errorf("invalid pattern %q: %w", p, err)
+		}
+		if len(matches) == 0 {
+			return nil, fmt.Errorf("no files match %q", p)
+		}
+		expanded = append(expanded, matches...)
+	}
+	return expanded, nil
+}
+
+// checkPathArgs rejects flags passed after the paths, which are taken as
+// paths since flags stop being parsed at the first argument
+func checkPathArgs(paths []string) error {
+	for _, p := range paths {
+		if strings.HasPrefix(p, "-") && p != "-" {
+			return fmt.Errorf("flags must come before paths: %s", p)
+		}
+	}
+	return nil
+}
+
+// UploadPaths uploads a single path like Upload, or uploads many paths as
+// separate files with up to concurrency uploads at a time and reports the
+// result of each
+func UploadPaths(paths []string, options UploadOptions, concurrency int) ([]UploadResult, error) {
+	for _, p := range paths {
+		if p == "-" && len(paths) > 1 {
+			return nil, errors.New("stdin can't be uploaded along with other paths")
+		}
+	}
+	if options.MimeType != "" && (len(paths) > 1 || paths[0] != "-") {
+		return nil, errors.New("--mime can only be used when uploading from stdin")
+	}
+	if paths[0] == "-" && options.SkipExisting {
+		return nil, errors.New("--skip-existing can't be used when uploading from stdin")
+	}
+
+	if len(paths) == 1 && !strings.ContainsAny(paths[0], "*?[") {
+		var response UploadResponse
+		var err error
+		if paths[0] == "-" {
+			response, err = UploadStdin(options)
+		} else {
+			response, err = Upload(paths[0], options)
+		}
+		result := uploadResult(paths[0], response)
+		if err != nil {
+			// A failed verification still returns what was uploaded
+			result.Error = err.Error()
+			return []UploadResult{result}, err
+		}
+		err = render(response.Data, response.Data)
+		if err != nil {
+			return nil, err
+		}
+		return []UploadResult{result}, nil
+	}
+
+	paths, err := expandPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	if options.Name != "nil" && len(paths) > 1 {
+		return nil, errors.New("--name can only be used when uploading a single path")
+	}
+	// Each upload in flight gets its own bar
+	var progress *multiProgress
+	if options.Verbose {
+		var total int64
+		for _, p := range paths {
+			size, _ := pathSize(p, options.Filter)
+			total += size
+		}
+		fmt.Printf("Uploading %d paths (%s)\n", len(paths), formatSize(int(total)))
+		progress = newMultiProgress(os.Stdout)
+		options.Verbose = false
+	}
+
+	results := make([]UploadResult, len(paths))
+	forEachConcurrently(len(paths), concurrency, func(i int) {
+		fileOptions := options
+		var end func(message string)
+		if progress != nil {
+			size, _ := pathSize(paths[i], options.Filter)
+			fileOptions.progress, end = progress.Add(paths[i], size)
+		}
+		response, err := Upload(paths[i], fileOptions)
+		// A failed verification still returns what was uploaded
+		results[i] = uploadResult(paths[i], response)
+		if err != nil {
+			results[i].Error = err.Error()
+		}
+
+		if end != nil {
+			if err != nil {
+				end(fmt.Sprintf("Failed %s", paths[i]))
+			} else {
+				end(fmt.Sprintf("Uploaded %s (%s)", paths[i], formatSize(response.Data.Size)))
+			}
+		}
+	})
+	if progress != nil {
+		progress.Stop()
+	}
+
+	err = render(results, results)
+	if err != nil {
+		return nil, err
+	}
+
+	var failed int
+	for _, result := range results {
+		if result.Error != "" {
+			failed++
+			fmt.Fprintf(os.Stderr, "Failed to upload %s: %s\n", result.Path, result.Error)
+		}
+	}
+	fmt.Fprintf(os.Stderr, "Uploaded %d of %d paths\n", len(paths)-failed, len(paths))
+	if failed > 0 {
+		return results, fmt.Errorf("%d of %d uploads failed", failed, len(paths))
+	}
+
+	return results, nil
+}
+
+// forEachConcurrently calls fn with every index up to count, running up to
+// concurrency calls at a time
+func forEachConcurrently(count int, concurrency int, fn func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency && w < count; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				fn(i)
+			}
+		}()
+	}
+	for i := 0; i < count; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+}
+
+func uploadResult(path string, response UploadResponse) UploadResult {
+	return UploadResult{
+		Path: path,
+		Id:   response.Data.Id,
+		Name: response.Data.Name,
+		Cid:  response.Data.Cid,
+		Size: response.Data.Size,
+
+		response: response,
+	}
+}
+
+// pathSize is the size of a file or the files in a folder
+func pathSize(path string, filter PathFilter) (int64, error) {
+	stats, err := os.Stat(path)
+	if err != nil {
+		return 0, err
+	}
+	files, err := pathsFinder(path, stats, filter)
+	if err != nil {
+		return 0, err
+	}
+	return filesSize(files)
+}
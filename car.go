@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// carWriter writes blocks to a CARv1 file, skipping blocks it has already
+// written
+type carWriter struct {
+	w       *bufio.Writer
+	written map[string]bool
+}
+
+func (c *carWriter) WriteBlock(id cid, data []byte) error {
+	if c.written[string(id)] {
+		return nil
+	}
+	c.written[string(id)] = true
+
+	section := binary.AppendUvarint(nil, uint64(len(id)+len(data)))
+	section = append(section, id...)
+	_, err := c.w.Write(section)
+	if err != nil {
+		return err
+	}
+	_, err = c.w.Write(data)
+	return err
+}
+
+// carHeader encodes the dag-cbor header {"roots": [root], "version": 1}
+func carHeader(root cid) []byte {
+	var header []byte
+	header = append(header, 0xa2)
+	header = append(header, 0x65)
+	header = append(header, "roots"...)
+	header = append(header, 0x81)
+	// CIDs are tag 42 byte strings with a leading zero byte
+	header = append(header, 0xd8, 0x2a, 0x58, byte(len(root)+1), 0x00)
+	header = append(header, root...)
+	header = append(header, 0x67)
+	header = append(header, "version"...)
+	header = append(header, 0x01)
+	return append(binary.AppendUvarint(nil, uint64(len(header))), header...)
+}
+
+// carCacheDir is where folders are packed before they are uploaded
+func carCacheDir() (string, error) {
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "pinata", "car"), nil
+}
+
+// carCacheMaxAge is how long a packed folder that no saved upload uses is
+// kept, in case another run is about to upload it
+const carCacheMaxAge = 24 * time.Hour
+
+// savedCARs are the packed folders of the uploads saved to be resumed
+func savedCARs() (map[string]bool, error) {
+	records, err := loadUploadRecords()
+	if err != nil {
+		return nil, err
+	}
+	paths := map[string]bool{}
+	for _, record := range records {
+		if record.Car {
+			paths[record.Path] = true
+		}
+	}
+	return paths, nil
+}
+
+// pruneCARCache removes the packed folders that no saved upload uses, left
+// behind by uploads that failed before they were created or whose record was
+// removed
+func pruneCARCache() error {
+	dir, err := carCacheDir()
+	if err != nil {
+		return err
+	}
+	entries, err := os.ReadDir(dir)
+	if os.IsNotExist(err) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	saved, err := savedCARs()
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		info, err := entry.Info()
+		if err != nil || saved[path] || time.Since(info.ModTime()) < carCacheMaxAge {
+			continue
+		}
+		os.Remove(path)
+	}
+	return nil
+}
+
+// carCachePath names the CAR of a folder after its files, sizes and mtimes
+// so an interrupted upload finds the same CAR and can resume it
+func carCachePath(root string, files []string) (string, error) {
+	dir, err := carCacheDir()
+	if err != nil {
+		return "", err
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n", absRoot)
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return "", err
+		}
+		rel, _ := filepath.Rel(root, f)
+		fmt.Fprintf(h, "%s\n%d\n%d\n", rel, info.Size(), info.ModTime().UnixNano())
+	}
+	return filepath.Join(dir, hex.EncodeToString(h.Sum(nil))[:32]+".car"), nil
+}
+
+// writeDirectoryCAR packs the files of root into a CAR and returns its path.
+// A CAR already packed for the same files is reused.
+func writeDirectoryCAR(root string, files []string) (string, error) {
+	// Old CARs are cleaned up whenever a new one is packed
+	pruneCARCache()
+
+	carPath, err := carCachePath(root, files)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(carPath); err == nil {
+		return carPath, nil
+	}
+	err = os.MkdirAll(filepath.Dir(carPath), 0700)
+	if err != nil {
+		return "", err
+	}
+
+	tmpPath := carPath + ".tmp"
+	out, err := os.Create(tmpPath)
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(tmpPath)
+	defer out.Close()
+
+	// The root of a directory is always a dag-pb CID of the same length, so
+	// space for the header is left and it's filled in once the root is known
+	placeholder := carHeader(newCID(codecDagPB, nil))
+	_, err = out.Write(make([]byte, len(placeholder)))
+	if err != nil {
+		return "", err
+	}
+
+	writer := &carWriter{w: bufio.NewWriter(out), written: map[string]bool{}}
+	builder := &dagBuilder{out: writer}
+	link, err := builder.addDirectory(root, files)
+	if err != nil {
+		return "", err
+	}
+	err = writer.w.Flush()
+	if err != nil {
+		return "", err
+	}
+
+	_, err = out.WriteAt(carHeader(link.Cid), 0)
+	if err != nil {
+		return "", err
+	}
+	err = out.Close()
+	if err != nil {
+		return "", err
+	}
+
+	return carPath, os.Rename(tmpPath, carPath)
+}
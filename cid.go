@@ -0,0 +1,119 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+type CIDResult struct {
+	Path          string `json:"path"`
+	Cid           string `json:"cid"`
+	Size          int64  `json:"size"`
+	NumberOfFiles int    `json:"number_of_files"`
+}
+
+// ComputeCIDs computes the CIDs paths get once uploaded, without uploading
+// them. Folders only include the files selected by filter, and - reads the
+// content piped to stdin.
+func ComputeCIDs(paths []string, filter PathFilter) ([]CIDResult, error) {
+	var results []CIDResult
+	if len(paths) == 1 && paths[0] == "-" {
+		counter := &countingWriter{}
+		c, err := readerCID(io.TeeReader(os.Stdin, counter))
+		if err != nil {
+			return nil, errors.Join(err, errors.New("failed to read stdin"))
+		}
+		results = append(results, CIDResult{Path: "-", Cid: c, Size: counter.n, NumberOfFiles: 1})
+	} else {
+		expanded, err := expandPaths(paths)
+		if err != nil {
+			return nil, err
+		}
+		for _, p := range expanded {
+			if p == "-" {
+				return nil, errors.New("stdin can't be read along with other paths")
+			}
+			result, err := pathCID(p, filter)
+			if err != nil {
+				return nil, err
+			}
+			results = append(results, result)
+		}
+	}
+
+	err := render(results, results)
+	if err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// pathCID computes the CID of a file, or of a folder with the files that
+// would be uploaded from it
+func pathCID(path string, filter PathFilter) (CIDResult, error) {
+	stats, err := os.Stat(path)
+	if err != nil {
+		return CIDResult{}, err
+	}
+
+	builder := &dagBuilder{}
+	if !stats.IsDir() {
+		link, err := builder.addFile(path)
+		if err != nil {
+			return CIDResult{}, err
+		}
+		return CIDResult{Path: path, Cid: link.Cid.String(), Size: stats.Size(), NumberOfFiles: 1}, nil
+	}
+
+	files, err := pathsFinder(path, stats, filter)
+	if err != nil {
+		return CIDResult{}, err
+	}
+	size, err := filesSize(files)
+	if err != nil {
+		return CIDResult{}, err
+	}
+	link, err := builder.addDirectory(path, files)
+	if err != nil {
+		return CIDResult{}, err
+	}
+	return CIDResult{Path: path, Cid: link.Cid.String(), Size: size, NumberOfFiles: len(files)}, nil
+}
+
+func readerCID(r io.Reader) (string, error) {
+	builder := &dagBuilder{}
+	link, err := builder.addReader(r)
+	if err != nil {
+		return "", err
+	}
+	return link.Cid.String(), nil
+}
+
+// streamCID computes the CID of what is written to the returned writer while
+// it is being uploaded. wait returns the CID once the writer is closed.
+func streamCID() (w *io.PipeWriter, wait func() (string, error)) {
+	pr, pw := io.Pipe()
+	var c string
+	var err error
+	done := make(chan struct{})
+	go func() {
+		c, err = readerCID(pr)
+		pr.CloseWithError(err)
+		close(done)
+	}()
+	return pw, func() (string, error) {
+		<-done
+		return c, err
+	}
+}
+
+// verifyCID fails when the CID returned for an upload isn't the one computed
+// locally, which means the content was changed or corrupted on the way
+func verifyCID(path string, local string, response UploadResponse) error {
+	if response.Data.Cid == local {
+		return nil
+	}
+	return fmt.Errorf("CID mismatch for %s: computed %s locally but the upload %s has CID %s", path, local, response.Data.Id, response.Data.Cid)
+}
@@ -0,0 +1,163 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+)
+
+// Client wraps the Pinata API so every command shares the same base URLs,
+// authentication and response handling.
+type Client struct {
+	BaseURL    string
+	UploadsURL string
+	JWT        string
+	HTTPClient *http.Client
+	Retry      RetryPolicy
+}
+
+func NewClient() (*Client, error) {
+	return NewClientForProfile("")
+}
+
+// NewClientForProfile is like NewClient but uses the credentials and hosts
+// of the named profile, or of the active profile when name is empty
+func NewClientForProfile(name string) (*Client, error) {
+	jwt, err := findTokenFor(name)
+	if err != nil {
+		return nil, err
+	}
+	return newProfileClient(name, string(jwt)), nil
+}
+
+func newClientWithToken(jwt string) *Client {
+	return newProfileClient("", jwt)
+}
+
+func newProfileClient(profile string, jwt string) *Client {
+	return &Client{
+		BaseURL:    hostURL(settingStringFor(profile, "api_host")),
+		UploadsURL: hostURL(settingStringFor(profile, "uploads_host")),
+		JWT:        jwt,
+		HTTPClient: &http.Client{},
+		Retry:      retryPolicy,
+	}
+}
+
+func (c *Client) NewRequest(method string, url string, body io.Reader) (*http.Request, error) {
+	req, err := http.NewRequest(method, url, body)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to create the request"))
+	}
+	req.Header.Set("Authorization", "Bearer "+c.JWT)
+	req.Header.Set("content-type", "application/json")
+	return req, nil
+}
+
+// Do sends the request and decodes a successful JSON response into out,
+// which may be nil when the body is not needed. Idempotent requests are
+// retried according to the client's RetryPolicy.
+func (c *Client) Do(req *http.Request, out interface{}) error {
+	return c.do(req, out, isIdempotent(req.Method))
+}
+
+// DoWithRetry is like Do but retries the request regardless of its method,
+// for requests such as uploads that are safe to send again. The request
+// needs a GetBody func if it has a body.
+func (c *Client) DoWithRetry(req *http.Request, out interface{}) error {
+	return c.do(req, out, true)
+}
+
+func (c *Client) do(req *http.Request, out interface{}, retryable bool) error {
+	resp, err := c.send(req, retryable)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if out == nil {
+		return nil
+	}
+	return json.NewDecoder(resp.Body).Decode(out)
+}
+
+// send is like do but returns the successful response, for requests whose
+// headers are needed. The caller has to close the body.
+func (c *Client) send(req *http.Request, retryable bool) (*http.Response, error) {
+	if req.Body != nil && req.GetBody == nil {
+		retryable = false
+	}
+
+	for attempt := 0; ; attempt++ {
+		if attempt > 0 && req.GetBody != nil {
+			body, err := req.GetBody()
+			if err != nil {
+				return nil, errors.Join(err, errors.New("failed to rewind the request body"))
+			}
+			req.Body = body
+		}
+
+		resp, err := c.HTTPClient.Do(req)
+		canRetry := retryable && attempt < c.Retry.MaxRetries
+		if err != nil {
+			if canRetry {
+				c.Retry.wait(attempt, nil, err.Error())
+				continue
+			}
+			return nil, errors.Join(err, errors.New("failed to send the request"))
+		}
+
+		if resp.StatusCode < 200 || resp.StatusCode > 299 {
+			apiErr := newAPIError(resp)
+			resp.Body.Close()
+			if canRetry && shouldRetryStatus(resp.StatusCode) {
+				c.Retry.wait(attempt, resp, fmt.Sprintf("server returned %d", resp.StatusCode))
+				continue
+			}
+			return nil, apiErr
+		}
+
+		return resp, nil
+	}
+}
+
+func (c *Client) Get(path string, query url.Values, out interface{}) error {
+	return c.request("GET", path, query, nil, out)
+}
+
+func (c *Client) Post(path string, payload interface{}, out interface{}) error {
+	return c.request("POST", path, nil, payload, out)
+}
+
+func (c *Client) Put(path string, payload interface{}, out interface{}) error {
+	return c.request("PUT", path, nil, payload, out)
+}
+
+func (c *Client) Delete(path string) error {
+	return c.request("DELETE", path, nil, nil, nil)
+}
+
+func (c *Client) request(method string, path string, query url.Values, payload interface{}, out interface{}) error {
+	endpoint := c.BaseURL + path
+	if len(query) > 0 {
+		endpoint += "?" + query.Encode()
+	}
+
+	var body io.Reader
+	if payload != nil {
+		jsonPayload, err := json.Marshal(payload)
+		if err != nil {
+			return errors.Join(err, errors.New("Failed to marshal paylod"))
+		}
+		body = bytes.NewReader(jsonPayload)
+	}
+
+	req, err := c.NewRequest(method, endpoint, body)
+	if err != nil {
+		return err
+	}
+	return c.Do(req, out)
+}
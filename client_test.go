@@ -0,0 +1,155 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newTestClient(server *httptest.Server, maxRetries int) *Client {
+	return &Client{
+		BaseURL:    server.URL,
+		UploadsURL: server.URL,
+		JWT:        "test-jwt",
+		HTTPClient: server.Client(),
+		Retry:      RetryPolicy{MaxRetries: maxRetries, MaxBackoff: time.Millisecond},
+	}
+}
+
+func TestClientGet(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Header.Get("Authorization") != "Bearer test-jwt" {
+			t.Errorf("Authorization = %q", r.Header.Get("Authorization"))
+		}
+		if r.URL.Path != "/v3/files/abc" || r.URL.Query().Get("limit") != "1" {
+			t.Errorf("request to %s", r.URL)
+		}
+		fmt.Fprint(w, `{"data": {"id": "abc", "cid": "bafy"}}`)
+	}))
+	defer server.Close()
+
+	var response UploadResponse
+	err := newTestClient(server, 0).Get("/v3/files/abc", url.Values{"limit": {"1"}}, &response)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if response.Data.Id != "abc" || response.Data.Cid != "bafy" {
+		t.Errorf("decoded %+v", response.Data)
+	}
+}
+
+func TestClientAPIError(t *testing.T) {
+	tests := []struct {
+		status   int
+		body     string
+		message  string
+		exitCode int
+	}{
+		{http.StatusBadRequest, `{"message": "invalid group"}`, "invalid group", ExitRequestError},
+		{http.StatusUnauthorized, `{"error": "Unauthorized"}`, "Unauthorized", ExitUnauthorized},
+		{http.StatusForbidden, `{"error": {"reason": "FORBIDDEN", "details": "missing scope"}}`, "FORBIDDEN: missing scope", ExitForbidden},
+		{http.StatusNotFound, `not found`, "not found", ExitNotFound},
+		{http.StatusTooManyRequests, `{"error": {"message": "slow down"}}`, "slow down", ExitRateLimited},
+		{http.StatusInternalServerError, `{"error": "boom"}`, "boom", ExitServerError},
+	}
+	for _, test := range tests {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(test.status)
+			fmt.Fprint(w, test.body)
+		}))
+
+		err := newTestClient(server, 0).Delete("/v3/files/abc")
+		server.Close()
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			t.Errorf("status %d: got %v, want an APIError", test.status, err)
+			continue
+		}
+		if apiErr.StatusCode != test.status || apiErr.Method != "DELETE" || apiErr.Message != test.message {
+			t.Errorf("status %d: got %+v, want message %q", test.status, apiErr, test.message)
+		}
+		if code := exitCode(fmt.Errorf("failed: %w", err)); code != test.exitCode {
+			t.Errorf("status %d: exit code %d, want %d", test.status, code, test.exitCode)
+		}
+	}
+
+	if code := exitCode(errors.New("no JWT")); code != ExitError {
+		t.Errorf("exit code %d for other errors, want %d", code, ExitError)
+	}
+}
+
+func TestClientRetries(t *testing.T) {
+	tests := []struct {
+		method   string
+		failures int32
+		attempts int32
+		fails    bool
+	}{
+		// Idempotent requests are retried
+		{"GET", 2, 3, false},
+		{"GET", 5, 4, true},
+		// POST isn't unless it's sent with DoWithRetry
+		{"POST", 1, 1, true},
+	}
+	for _, test := range tests {
+		var attempts int32
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if atomic.AddInt32(&attempts, 1) <= test.failures {
+				w.WriteHeader(http.StatusServiceUnavailable)
+				return
+			}
+			fmt.Fprint(w, `{}`)
+		}))
+
+		client := newTestClient(server, 3)
+		req, err := client.NewRequest(test.method, server.URL+"/v3/files", nil)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = client.Do(req, nil)
+		server.Close()
+
+		if (err != nil) != test.fails {
+			t.Errorf("%s after %d failures: got error %v", test.method, test.failures, err)
+		}
+		if attempts != test.attempts {
+			t.Errorf("%s after %d failures: %d attempts, want %d", test.method, test.failures, attempts, test.attempts)
+		}
+	}
+}
+
+func TestClientDoWithRetry(t *testing.T) {
+	var bodies []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		bodies = append(bodies, string(body))
+		if len(bodies) == 1 {
+			w.WriteHeader(http.StatusBadGateway)
+			return
+		}
+		fmt.Fprint(w, `{}`)
+	}))
+	defer server.Close()
+
+	client := newTestClient(server, 1)
+	req, err := client.NewRequest("POST", server.URL+"/v3/files", strings.NewReader("file"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.DoWithRetry(req, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The body is rewound for the retry
+	if len(bodies) != 2 || bodies[0] != "file" || bodies[1] != "file" {
+		t.Errorf("server received %q", bodies)
+	}
+}
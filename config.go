@@ -0,0 +1,284 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/BurntSushi/toml"
+)
+
+const defaultProfileName = "default"
+
+type Config struct {
+	CurrentProfile string                 `toml:"current_profile,omitempty"`
+	Defaults       map[string]interface{} `toml:"defaults,omitempty"`
+	Profiles       map[string]*Profile    `toml:"profiles,omitempty"`
+}
+
+type ConfigItem struct {
+	Key    string `json:"key"`
+	Value  string `json:"value"`
+	Source string `json:"source"`
+}
+
+type Profile struct {
+	JWT         string `toml:"jwt,omitempty"`
+	Gateway     string `toml:"gateway,omitempty"`
+	Group       string `toml:"group,omitempty"`
+	APIHost     string `toml:"api_host,omitempty"`
+	UploadsHost string `toml:"uploads_host,omitempty"`
+}
+
+// profileFlag is the profile chosen with --profile or PINATA_PROFILE
+var profileFlag string
+
+func configDir() (string, error) {
+	if dir := os.Getenv("XDG_CONFIG_HOME"); dir != "" {
+		return filepath.Join(dir, "pinata"), nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(home, ".config", "pinata"), nil
+}
+
+func configPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.toml"), nil
+}
+
+// loadConfig reads the config file, importing the credentials saved by
+// older versions of the CLI into the default profile when it doesn't exist
+func loadConfig() (*Config, error) {
+	config := &Config{Defaults: map[string]interface{}{}, Profiles: map[string]*Profile{}}
+
+	p, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+		legacy, err := loadLegacyProfile()
+		if err != nil {
+			return nil, err
+		}
+		if legacy != nil {
+			config.Profiles[defaultProfileName] = legacy
+		}
+		return config, nil
+	}
+
+	_, err = toml.Decode(string(data), config)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to parse config file "+p))
+	}
+	if config.Defaults == nil {
+		config.Defaults = map[string]interface{}{}
+	}
+	if config.Profiles == nil {
+		config.Profiles = map[string]*Profile{}
+	}
+	return config, nil
+}
+
+func loadLegacyProfile() (*Profile, error) {
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return nil, err
+	}
+	jwt, err := os.ReadFile(filepath.Join(home, ".pinata-files-cli"))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	profile := &Profile{JWT: strings.TrimSpace(string(jwt))}
+	gateway, err := os.ReadFile(filepath.Join(home, ".pinata-files-cli-gateway"))
+	if err == nil {
+		profile.Gateway = strings.TrimSpace(string(gateway))
+	}
+	return profile, nil
+}
+
+func saveConfig(config *Config) error {
+	p, err := configPath()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0700)
+	if err != nil {
+		return err
+	}
+
+	buf := &bytes.Buffer{}
+	err = toml.NewEncoder(buf).Encode(config)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, buf.Bytes(), 0600)
+}
+
+func (c *Config) ActiveProfileName() string {
+	if profileFlag != "" {
+		return profileFlag
+	}
+	if c.CurrentProfile != "" {
+		return c.CurrentProfile
+	}
+	return defaultProfileName
+}
+
+// ActiveProfile returns the active profile, or an empty one if it hasn't
+// been saved yet
+func (c *Config) ActiveProfile() *Profile {
+	return c.Profile(c.ActiveProfileName())
+}
+
+// Profile returns the named profile, or an empty one if it hasn't been saved
+func (c *Config) Profile(name string) *Profile {
+	profile, ok := c.Profiles[name]
+	if !ok {
+		return &Profile{}
+	}
+	return profile
+}
+
+// activeProfile loads the config and returns the active profile, treating a
+// missing or unreadable config as an empty profile
+func activeProfile() *Profile {
+	config, err := loadConfig()
+	if err != nil {
+		return &Profile{}
+	}
+	return config.ActiveProfile()
+}
+
+// updateProfile applies update to the active profile and saves the config
+func updateProfile(update func(profile *Profile)) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	name := config.ActiveProfileName()
+	profile, ok := config.Profiles[name]
+	if !ok {
+		profile = &Profile{}
+		config.Profiles[name] = profile
+	}
+	update(profile)
+	return saveConfig(config)
+}
+
+func ConfigList() ([]ConfigItem, error) {
+	items := make([]ConfigItem, len(settings))
+	for i, setting := range settings {
+		value, source := resolveSetting(setting.Key)
+		if setting.Secret && value != "" {
+			value = maskSecret(value)
+		}
+		items[i] = ConfigItem{
+			Key:    setting.Key,
+			Value:  value,
+			Source: source,
+		}
+	}
+
+	err := render(items, items)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func ConfigGet(key string) (string, error) {
+	_, err := findSetting(key)
+	if err != nil {
+		return "", err
+	}
+
+	value, _ := resolveSetting(key)
+	fmt.Println(value)
+
+	return value, nil
+}
+
+// ConfigSet saves a setting to the active profile if it belongs to one,
+// otherwise to the [defaults] table
+func ConfigSet(key string, value string) error {
+	setting, err := findSetting(key)
+	if err != nil {
+		return err
+	}
+	err = setting.validate(value)
+	if err != nil {
+		return err
+	}
+
+	if setting.Profile {
+		err = updateProfile(func(profile *Profile) {
+			profile.Set(key, value)
+		})
+	} else {
+		err = updateDefaults(func(defaults map[string]interface{}) {
+			defaults[key] = setting.typedValue(value)
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s set\n", key)
+	return nil
+}
+
+func ConfigUnset(key string) error {
+	setting, err := findSetting(key)
+	if err != nil {
+		return err
+	}
+
+	if setting.Profile {
+		err = updateProfile(func(profile *Profile) {
+			profile.Set(key, "")
+		})
+	} else {
+		err = updateDefaults(func(defaults map[string]interface{}) {
+			delete(defaults, key)
+		})
+	}
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%s unset\n", key)
+	return nil
+}
+
+func updateDefaults(update func(defaults map[string]interface{})) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	update(config.Defaults)
+	return saveConfig(config)
+}
+
+func maskSecret(value string) string {
+	if len(value) <= 8 {
+		return "********"
+	}
+	return "********" + value[len(value)-4:]
+}
@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	strategyMultipart = "multipart"
+	strategyTUS       = "tus"
+	strategyCAR       = "car"
+)
+
+// UploadPlan describes the upload of a path as Upload would make it
+type UploadPlan struct {
+	Path      string            `json:"path"`
+	Name      string            `json:"name"`
+	Strategy  string            `json:"strategy"`
+	Size      int64             `json:"size"`
+	GroupId   string            `json:"group_id,omitempty"`
+	KeyValues map[string]string `json:"keyvalues,omitempty"`
+	Files     []PlannedFile     `json:"files"`
+}
+
+// PlannedFile is a file of an upload, named as it is sent in the form
+type PlannedFile struct {
+	Path string `json:"path"`
+	Size int64  `json:"size"`
+}
+
+// PlanUploads lists what UploadPaths would send for paths without making any
+// requests. Tabular formats print one line per file and a summary of each
+// upload to stderr.
+func PlanUploads(paths []string, options UploadOptions) ([]UploadPlan, error) {
+	for _, p := range paths {
+		if p == "-" {
+			return nil, errors.New("--dry-run can't be used when uploading from stdin")
+		}
+	}
+	if options.MimeType != "" {
+		return nil, errors.New("--mime can only be used when uploading from stdin")
+	}
+	paths, err := expandPaths(paths)
+	if err != nil {
+		return nil, err
+	}
+	if options.Name != "nil" && len(paths) > 1 {
+		return nil, errors.New("--name can only be used when uploading a single path")
+	}
+
+	plans := make([]UploadPlan, len(paths))
+	var rows []PlannedFile
+	for i, p := range paths {
+		plans[i], err = planUpload(p, options)
+		if err != nil {
+			return nil, err
+		}
+		rows = append(rows, plans[i].Files...)
+	}
+
+	err = render(plans, rows)
+	if err != nil {
+		return nil, err
+	}
+	if isTabular() {
+		for _, plan := range plans {
+			fmt.Fprintln(os.Stderr, plan.summary())
+		}
+	}
+
+	return plans, nil
+}
+
+// planUpload mirrors the choices made by Upload for a single path
+func planUpload(filePath string, options UploadOptions) (UploadPlan, error) {
+	stats, err := os.Stat(filePath)
+	if err != nil {
+		return UploadPlan{}, err
+	}
+
+	files := []string{filePath}
+	if stats.IsDir() {
+		files, err = pathsFinder(filePath, stats, options.Filter)
+		if err != nil {
+			return UploadPlan{}, err
+		}
+	}
+
+	plan := UploadPlan{
+		Path:      filePath,
+		Name:      stats.Name(),
+		Strategy:  strategyMultipart,
+		GroupId:   options.GroupId,
+		KeyValues: options.KeyValues,
+		Files:     make([]PlannedFile, len(files)),
+	}
+	if options.Name != "nil" {
+		plan.Name = options.Name
+	}
+	for i, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return UploadPlan{}, err
+		}
+		name := filepath.Base(f)
+		if stats.IsDir() {
+			relPath, _ := filepath.Rel(filePath, f)
+			name = filepath.ToSlash(filepath.Join(stats.Name(), relPath))
+		}
+		plan.Files[i] = PlannedFile{Path: name, Size: info.Size()}
+		plan.Size += info.Size()
+	}
+
+	if plan.Size > int64(settingInt("upload_threshold")) {
+		plan.Strategy = strategyTUS
+		if stats.IsDir() {
+			plan.Strategy = strategyCAR
+		}
+	}
+
+	return plan, nil
+}
+
+func (p UploadPlan) summary() string {
+	strategy := "a regular upload"
+	switch p.Strategy {
+	case strategyTUS:
+		strategy = "a resumable TUS upload"
+	case strategyCAR:
+		strategy = "a CAR with a resumable TUS upload"
+	}
+
+	files := fmt.Sprintf("%d files", len(p.Files))
+	if len(p.Files) == 1 {
+		files = "1 file"
+	}
+	s := fmt.Sprintf("%s: %s (%s) as %s named %q", p.Path, files, formatSize(int(p.Size)), strategy, p.Name)
+	if p.GroupId != "" {
+		s += fmt.Sprintf(", group %s", p.GroupId)
+	}
+	if len(p.KeyValues) > 0 {
+		pairs := make([]string, 0, len(p.KeyValues))
+		for key, value := range p.KeyValues {
+			pairs = append(pairs, key+"="+value)
+		}
+		sort.Strings(pairs)
+		s += fmt.Sprintf(", keyvalues %s", strings.Join(pairs, " "))
+	}
+	return s
+}
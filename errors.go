@@ -0,0 +1,148 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/eventials/go-tus"
+)
+
+// Exit codes returned by the CLI so scripts can branch on the kind of failure
+const (
+	ExitError        = 1
+	ExitUnauthorized = 3
+	ExitForbidden    = 4
+	ExitNotFound     = 5
+	ExitRateLimited  = 6
+	ExitServerError  = 7
+	ExitRequestError = 8
+)
+
+type APIError struct {
+	StatusCode int
+	Method     string
+	URL        string
+	Message    string
+}
+
+func (e *APIError) Error() string {
+	msg := fmt.Sprintf("%s %s returned %d %s", e.Method, e.URL, e.StatusCode, http.StatusText(e.StatusCode))
+	if e.Message != "" {
+		msg += ": " + e.Message
+	}
+	if hint := e.Hint(); hint != "" {
+		msg += "\n" + hint
+	}
+	return msg
+}
+
+func (e *APIError) Hint() string {
+	switch e.StatusCode {
+	case http.StatusUnauthorized:
+		return "Your JWT was rejected, run the 'auth' command to authorize the CLI again"
+	case http.StatusForbidden:
+		return "Your API key does not have permission to use this endpoint, check the key's scopes"
+	case http.StatusNotFound:
+		return "The requested resource could not be found, check the ID or CID"
+	case http.StatusTooManyRequests:
+		return "You are being rate limited by Pinata, wait a moment and try again"
+	}
+	return ""
+}
+
+func (e *APIError) ExitCode() int {
+	switch {
+	case e.StatusCode == http.StatusUnauthorized:
+		return ExitUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ExitForbidden
+	case e.StatusCode == http.StatusNotFound:
+		return ExitNotFound
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ExitRateLimited
+	case e.StatusCode >= 500:
+		return ExitServerError
+	default:
+		return ExitRequestError
+	}
+}
+
+func newAPIError(resp *http.Response) *APIError {
+	body, _ := io.ReadAll(io.LimitReader(resp.Body, 64*1024))
+	apiErr := &APIError{
+		StatusCode: resp.StatusCode,
+		Message:    parseErrorMessage(body),
+	}
+	if resp.Request != nil {
+		apiErr.Method = resp.Request.Method
+		apiErr.URL = resp.Request.URL.String()
+	}
+	return apiErr
+}
+
+// parseErrorMessage pulls the message out of the different error shapes the
+// Pinata API responds with, falling back to the raw body
+func parseErrorMessage(body []byte) string {
+	var payload struct {
+		Error   json.RawMessage `json:"error"`
+		Message string          `json:"message"`
+		Reason  string          `json:"reason"`
+		Details string          `json:"details"`
+	}
+	if err := json.Unmarshal(body, &payload); err != nil {
+		return strings.TrimSpace(string(body))
+	}
+
+	if len(payload.Error) > 0 {
+		var message string
+		if err := json.Unmarshal(payload.Error, &message); err == nil {
+			return message
+		}
+		var nested struct {
+			Reason  string `json:"reason"`
+			Details string `json:"details"`
+			Message string `json:"message"`
+		}
+		if err := json.Unmarshal(payload.Error, &nested); err == nil {
+			return joinMessage(nested.Reason, nested.Details, nested.Message)
+		}
+	}
+
+	return joinMessage(payload.Reason, payload.Details, payload.Message)
+}
+
+func joinMessage(parts ...string) string {
+	nonEmpty := []string{}
+	for _, part := range parts {
+		if part != "" {
+			nonEmpty = append(nonEmpty, part)
+		}
+	}
+	return strings.Join(nonEmpty, ": ")
+}
+
+// tusError converts status code errors from the TUS client into an APIError
+func tusError(err error, method string, url string) error {
+	var clientErr tus.ClientError
+	if errors.As(err, &clientErr) {
+		return &APIError{
+			StatusCode: clientErr.Code,
+			Method:     method,
+			URL:        url,
+			Message:    parseErrorMessage(clientErr.Body),
+		}
+	}
+	return err
+}
+
+func exitCode(err error) int {
+	var apiErr *APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.ExitCode()
+	}
+	return ExitError
+}
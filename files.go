@@ -1,37 +1,20 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
-	"strings"
+	"net/url"
 )
 
 func DeleteFile(id string) error {
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return err
 	}
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files/%s", id)
 
-	req, err := http.NewRequest("DELETE", url, nil)
+	err = client.Delete(fmt.Sprintf("/v3/files/%s", id))
 	if err != nil {
-		return errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("server Returned an error %d, check CID", resp.StatusCode)
+		return err
 	}
 
 	fmt.Println("File Deleted")
@@ -41,314 +24,212 @@ func DeleteFile(id string) error {
 }
 
 func GetFile(id string) (GetFileResponse, error) {
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return GetFileResponse{}, err
 	}
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files/%s", id)
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return GetFileResponse{}, errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return GetFileResponse{}, errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return GetFileResponse{}, fmt.Errorf("server Returned an error %d", resp.StatusCode)
-	}
 	var response GetFileResponse
-
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	err = client.Get(fmt.Sprintf("/v3/files/%s", id), nil, &response)
 	if err != nil {
 		return GetFileResponse{}, err
 	}
-	formattedJSON, err := json.MarshalIndent(response.Data, "", "    ")
+	err = render(response.Data, response.Data)
 	if err != nil {
-		return GetFileResponse{}, errors.New("failed to format JSON")
+		return GetFileResponse{}, err
 	}
 
-	fmt.Println(string(formattedJSON))
-
 	return response, nil
 
 }
 
-func UpdateFile(id string, name string) (GetFileResponse, error) {
-	jwt, err := findToken()
+// findFileByCID returns a file of the account with the given CID, or nil if
+// there isn't one
+func findFileByCID(client *Client, cid string) (*File, error) {
+	params := url.Values{}
+	params.Set("cid", cid)
+	params.Set("limit", "1")
+
+	var response ListResponse
+	err := client.Get("/v3/files", params, &response)
 	if err != nil {
-		return GetFileResponse{}, err
+		return nil, err
 	}
-	payload := FileUpdateBody{
-		Name: name,
+	if len(response.Data.Files) == 0 {
+		return nil, nil
 	}
+	return &response.Data.Files[0], nil
+}
 
-	jsonPayload, err := json.Marshal(payload)
-
-	if err != nil {
-		return GetFileResponse{}, errors.Join(err, errors.New("Failed to marshal paylod"))
+// UpdateFile renames a file and changes its keyvalues. set and unset are
+// applied to the keyvalues the file already has, since the whole map is
+// replaced by the update.
+func UpdateFile(id string, name string, set map[string]string, unset []string) (GetFileResponse, error) {
+	if name == "" && len(set) == 0 && len(unset) == 0 {
+		return GetFileResponse{}, errors.New("nothing to update, provide a name or keyvalues to set or unset")
 	}
 
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files/%s", id)
-
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonPayload))
+	client, err := NewClient()
 	if err != nil {
-		return GetFileResponse{}, errors.Join(err, errors.New("failed to create the request"))
+		return GetFileResponse{}, err
 	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return GetFileResponse{}, errors.Join(err, errors.New("failed to send the request"))
+	payload := FileUpdateBody{
+		Name: name,
 	}
-	defer resp.Body.Close()
 
-	if resp.StatusCode != 200 {
-		return GetFileResponse{}, fmt.Errorf("server Returned an error %d", resp.StatusCode)
+	if len(set) > 0 || len(unset) > 0 {
+		var current GetFileResponse
+		err = client.Get(fmt.Sprintf("/v3/files/%s", id), nil, &current)
+		if err != nil {
+			return GetFileResponse{}, err
+		}
+		keyvalues := map[string]interface{}{}
+		for key, value := range current.Data.KeyValues {
+			keyvalues[key] = value
+		}
+		for key, value := range set {
+			keyvalues[key] = value
+		}
+		for _, key := range unset {
+			delete(keyvalues, key)
+		}
+		payload.KeyValues = &keyvalues
 	}
-	var response GetFileResponse
 
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	var response GetFileResponse
+	err = client.Put(fmt.Sprintf("/v3/files/%s", id), payload, &response)
 	if err != nil {
 		return GetFileResponse{}, err
 	}
-	formattedJSON, err := json.MarshalIndent(response.Data, "", "    ")
+	err = render(response.Data, response.Data)
 	if err != nil {
-		return GetFileResponse{}, errors.New("failed to format JSON")
+		return GetFileResponse{}, err
 	}
 
-	fmt.Println(string(formattedJSON))
-
 	return response, nil
 
 }
 
 func ListFiles(amount string, pageToken string, cidPending bool, name string, cid string, group string, mime_type string, keyvalues map[string]string) (ListResponse, error) {
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return ListResponse{}, err
 	}
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files?")
 
-	params := []string{}
+	params := url.Values{}
 
 	if name != "" {
-		params = append(params, "name="+name)
+		params.Set("name", name)
 	}
 
 	if cid != "" {
-		params = append(params, "cid="+cid)
+		params.Set("cid", cid)
 	}
 
 	if group != "" {
-		params = append(params, "group="+group)
+		params.Set("group", group)
 	}
 
 	if mime_type != "" {
-		params = append(params, "mimeType="+mime_type)
+		params.Set("mimeType", mime_type)
 	}
 
 	if amount != "" {
-		params = append(params, "limit="+amount)
+		params.Set("limit", amount)
 	}
 
 	if pageToken != "" {
-		params = append(params, "pageToken="+pageToken)
+		params.Set("pageToken", pageToken)
 	}
 
 	if cidPending {
-		params = append(params, "cidPending=true")
+		params.Set("cidPending", "true")
 	}
 
-	if len(keyvalues) > 0 {
-		for key, value := range keyvalues {
-			params = append(params, fmt.Sprintf("metadata[%s]=%s", key, value))
-		}
-	}
-
-	if len(params) > 0 {
-		url += strings.Join(params, "&")
-	}
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return ListResponse{}, errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return ListResponse{}, errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return ListResponse{}, fmt.Errorf("server Returned an error %d", resp.StatusCode)
+	for key, value := range keyvalues {
+		params.Set(fmt.Sprintf("metadata[%s]", key), value)
 	}
 
 	var response ListResponse
-
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	err = client.Get("/v3/files", params, &response)
 	if err != nil {
 		return ListResponse{}, err
 	}
-	formattedJSON, err := json.MarshalIndent(response.Data, "", "    ")
+	err = render(response.Data, response.Data.Files)
 	if err != nil {
-		return ListResponse{}, errors.New("failed to format JSON")
+		return ListResponse{}, err
 	}
-
-	fmt.Println(string(formattedJSON))
+	renderNextPage(response.Data.NextPageToken)
 
 	return response, nil
 
 }
 
 func GetSwapHistory(cid string, domain string) (GetSwapHistoryResponse, error) {
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return GetSwapHistoryResponse{}, err
 	}
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files/swap/%s?", cid)
 
-	params := []string{}
+	params := url.Values{}
 
 	if domain != "" {
-		params = append(params, "domain="+domain)
+		params.Set("domain", domain)
 	} else {
 		internalDomain, err := findGatewayDomain()
 		if err != nil {
 			return GetSwapHistoryResponse{}, err
 		}
-		params = append(params, "domain="+string(internalDomain))
-	}
-	if len(params) > 0 {
-		url += strings.Join(params, "&")
-	}
-
-	req, err := http.NewRequest("GET", url, nil)
-
-	if err != nil {
-		return GetSwapHistoryResponse{}, errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return GetSwapHistoryResponse{}, errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return GetSwapHistoryResponse{}, fmt.Errorf("server Returned an error %d", resp.StatusCode)
+		params.Set("domain", string(internalDomain))
 	}
 
 	var response GetSwapHistoryResponse
-
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	err = client.Get(fmt.Sprintf("/v3/files/swap/%s", cid), params, &response)
 	if err != nil {
 		return GetSwapHistoryResponse{}, err
 	}
-	formattedJSON, err := json.MarshalIndent(response.Data, "", "    ")
+	err = render(response.Data, response.Data)
 	if err != nil {
-		return GetSwapHistoryResponse{}, errors.New("failed to format JSON")
+		return GetSwapHistoryResponse{}, err
 	}
 
-	fmt.Println(string(formattedJSON))
-
 	return response, nil
 
 }
 
 func AddSwap(cid string, swapCid string) (AddSwapResponse, error) {
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return AddSwapResponse{}, err
 	}
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files/swap/%s", cid)
 
 	payload := AddSwapBody{
 		SwapCid: swapCid,
 	}
 
-	jsonPayload, err := json.Marshal(payload)
-
-	if err != nil {
-		return AddSwapResponse{}, errors.Join(err, errors.New("Failed to marshal paylod"))
-	}
-
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonPayload))
-
-	if err != nil {
-		return AddSwapResponse{}, errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return AddSwapResponse{}, errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return AddSwapResponse{}, fmt.Errorf("server Returned an error %d", resp.StatusCode)
-	}
-
 	var response AddSwapResponse
-
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	err = client.Put(fmt.Sprintf("/v3/files/swap/%s", cid), payload, &response)
 	if err != nil {
 		return AddSwapResponse{}, err
 	}
-	formattedJSON, err := json.MarshalIndent(response.Data, "", "    ")
+	err = render(response.Data, response.Data)
 	if err != nil {
-		return AddSwapResponse{}, errors.New("failed to format JSON")
+		return AddSwapResponse{}, err
 	}
 
-	fmt.Println(string(formattedJSON))
-
 	return response, nil
 
 }
 
 func RemoveSwap(cid string) error {
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return err
 	}
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files/swap/%s", cid)
-
-	req, err := http.NewRequest("DELETE", url, nil)
 
+	err = client.Delete(fmt.Sprintf("/v3/files/swap/%s", cid))
 	if err != nil {
-		return errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("server Returned an error %d", resp.StatusCode)
+		return err
 	}
 
 	fmt.Println("Swap deleted")
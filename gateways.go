@@ -1,13 +1,8 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
 	"errors"
 	"fmt"
-	"net/http"
-	"os"
-	"path/filepath"
 	"strings"
 	"time"
 
@@ -15,50 +10,33 @@ import (
 )
 
 func findGatewayDomain() ([]byte, error) {
-	homeDir, err := os.UserHomeDir()
+	config, err := loadConfig()
 	if err != nil {
 		return nil, err
 	}
-	dotFilePath := filepath.Join(homeDir, ".pinata-files-cli-gateway")
-	Domain, err := os.ReadFile(dotFilePath)
-	if err != nil {
-		if os.IsNotExist(err) {
-			return nil, errors.New("JWT not found. Please authorize first using the 'auth' command")
-		} else {
-			return nil, err
-		}
+	profile := config.ActiveProfile()
+	if profile.Gateway == "" {
+		return nil, fmt.Errorf("Gateway not found for profile %q. Please set one using the 'gateways set' command", config.ActiveProfileName())
 	}
-	return Domain, err
+	return []byte(profile.Gateway), nil
+}
+
+func gatewayURL(domain string, cid string) string {
+	return fmt.Sprintf("https://%s/files/%s", domain, cid)
 }
 
 func SetGateway(domain string) error {
 	if domain == "" {
-		jwt, err := findToken()
-		if err != nil {
-			return err
-		}
-		url := fmt.Sprintf("https://api.pinata.cloud/v3/ipfs/gateways")
-
-		req, err := http.NewRequest("GET", url, nil)
-		if err != nil {
-			return errors.Join(err, errors.New("failed to create the request"))
+		if !isInteractive() {
+			return errors.New("no gateway domain provided")
 		}
-		req.Header.Set("Authorization", "Bearer "+string(jwt))
-		req.Header.Set("content-type", "application/json")
-
-		client := &http.Client{}
-		resp, err := client.Do(req)
+		client, err := NewClient()
 		if err != nil {
-			return errors.Join(err, errors.New("failed to send the request"))
+			return err
 		}
-		defer resp.Body.Close()
 
-		if resp.StatusCode != 200 {
-			return fmt.Errorf("server Returned an error %d", resp.StatusCode)
-		}
 		var response GetGatewaysResponse
-
-		err = json.NewDecoder(resp.Body).Decode(&response)
+		err = client.Get("/v3/ipfs/gateways", nil, &response)
 		if err != nil {
 			return err
 		}
@@ -72,23 +50,12 @@ func SetGateway(domain string) error {
 			fmt.Println("Error:", err)
 			return nil
 		}
-		home, err := os.UserHomeDir()
-		if err != nil {
-			return err
-		}
-		p := filepath.Join(home, ".pinata-files-cli-gateway")
-		err = os.WriteFile(p, []byte(domain), 0600)
-		if err != nil {
-			return err
+		if domain == "" {
+			return nil
 		}
-		return nil
+		return saveGateway(domain)
 	}
-	home, err := os.UserHomeDir()
-	if err != nil {
-		return err
-	}
-	p := filepath.Join(home, ".pinata-files-cli-gateway")
-	err = os.WriteFile(p, []byte(domain), 0600)
+	err := saveGateway(domain)
 	if err != nil {
 		return err
 	}
@@ -97,9 +64,15 @@ func SetGateway(domain string) error {
 	return nil
 }
 
+func saveGateway(domain string) error {
+	return updateProfile(func(profile *Profile) {
+		profile.Gateway = domain
+	})
+}
+
 func GetSignedURL(cid string, expires int) (GetSignedURLResponse, error) {
 
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return GetSignedURLResponse{}, err
 	}
@@ -109,7 +82,7 @@ func GetSignedURL(cid string, expires int) (GetSignedURLResponse, error) {
 		return GetSignedURLResponse{}, err
 	}
 
-	domainUrl := fmt.Sprintf("https://%s/files/%s", domain, cid)
+	domainUrl := gatewayURL(string(domain), cid)
 
 	currentTime := time.Now().Unix()
 
@@ -120,33 +93,8 @@ func GetSignedURL(cid string, expires int) (GetSignedURLResponse, error) {
 		Method:  "GET",
 	}
 
-	jsonPayload, err := json.Marshal(payload)
-
-	if err != nil {
-		return GetSignedURLResponse{}, errors.Join(err, errors.New("Failed to marshal paylod"))
-	}
-
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files/sign")
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return GetSignedURLResponse{}, errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return GetSignedURLResponse{}, errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return GetSignedURLResponse{}, fmt.Errorf("server Returned an error %d", resp.StatusCode)
-	}
-
 	var response GetSignedURLResponse
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	err = client.Post("/v3/files/sign", payload, &response)
 	if err != nil {
 		return GetSignedURLResponse{}, err
 	}
@@ -160,7 +108,7 @@ func GetSignedURL(cid string, expires int) (GetSignedURLResponse, error) {
 }
 
 func OpenCID(cid string) error {
-	data, err := GetSignedURL(cid, 30)
+	data, err := GetSignedURL(cid, settingInt("sign_expires"))
 	if err != nil {
 		return fmt.Errorf("Problem creating URL %d", err)
 	}
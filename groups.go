@@ -1,121 +1,71 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"net/http"
-	"strings"
+	"net/url"
 )
 
 func GetGroup(id string) (GroupCreateResponse, error) {
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return GroupCreateResponse{}, err
 	}
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files/groups/%s", id)
 
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return GroupCreateResponse{}, errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return GroupCreateResponse{}, errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return GroupCreateResponse{}, fmt.Errorf("server Returned an error %d, check CID", resp.StatusCode)
-	}
 	var response GroupCreateResponse
-
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	err = client.Get(fmt.Sprintf("/v3/files/groups/%s", id), nil, &response)
 	if err != nil {
 		return GroupCreateResponse{}, err
 	}
-	formattedJSON, err := json.MarshalIndent(response.Data, "", "    ")
+	err = render(response.Data, response.Data)
 	if err != nil {
-		return GroupCreateResponse{}, errors.New("failed to format JSON")
+		return GroupCreateResponse{}, err
 	}
 
-	fmt.Println(string(formattedJSON))
-
 	return response, nil
 
 }
 
 func ListGroups(amount string, isPublic bool, name string, token string) (GroupListResponse, error) {
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return GroupListResponse{}, err
 	}
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files/groups?")
 
-	params := []string{}
+	params := url.Values{}
 
 	if amount != "" {
-		params = append(params, "limit="+amount)
+		params.Set("limit", amount)
 	}
 
 	if isPublic {
-		params = append(params, "isPublic=true")
+		params.Set("isPublic", "true")
 	}
 
 	if name != "" {
-		params = append(params, "name="+name)
+		params.Set("name", name)
 	}
 
 	if token != "" {
-		params = append(params, "pageToken="+token)
-	}
-
-	if len(params) > 0 {
-		url += strings.Join(params, "&")
-	}
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return GroupListResponse{}, errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return GroupListResponse{}, errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return GroupListResponse{}, fmt.Errorf("server Returned an error %d", resp.StatusCode)
+		params.Set("pageToken", token)
 	}
 
 	var response GroupListResponse
-
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	err = client.Get("/v3/files/groups", params, &response)
 	if err != nil {
 		return GroupListResponse{}, err
 	}
-	formattedJSON, err := json.MarshalIndent(response.Data, "", "    ")
+	err = render(response.Data, response.Data.Groups)
 	if err != nil {
-		return GroupListResponse{}, errors.New("failed to format JSON")
+		return GroupListResponse{}, err
 	}
-
-	fmt.Println(string(formattedJSON))
+	renderNextPage(response.Data.NextPageToken)
 
 	return response, nil
 
 }
 
 func CreateGroup(name string, isPublic bool) (GroupCreateResponse, error) {
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return GroupCreateResponse{}, err
 	}
@@ -125,50 +75,22 @@ func CreateGroup(name string, isPublic bool) (GroupCreateResponse, error) {
 		IsPublic: isPublic,
 	}
 
-	jsonPayload, err := json.Marshal(payload)
-
-	if err != nil {
-		return GroupCreateResponse{}, errors.Join(err, errors.New("Failed to marshal paylod"))
-	}
-
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files/groups")
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return GroupCreateResponse{}, errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return GroupCreateResponse{}, errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return GroupCreateResponse{}, fmt.Errorf("server Returned an error %d", resp.StatusCode)
-	}
-
 	var response GroupCreateResponse
-
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	err = client.Post("/v3/files/groups", payload, &response)
 	if err != nil {
 		return GroupCreateResponse{}, err
 	}
-	formattedJSON, err := json.MarshalIndent(response.Data, "", "    ")
+	err = render(response.Data, response.Data)
 	if err != nil {
-		return GroupCreateResponse{}, errors.New("failed to format JSON")
+		return GroupCreateResponse{}, err
 	}
 
-	fmt.Println(string(formattedJSON))
-
 	return response, nil
 
 }
 
 func UpdateGroup(id string, name string, isPublic bool) (GroupCreateResponse, error) {
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return GroupCreateResponse{}, err
 	}
@@ -178,71 +100,29 @@ func UpdateGroup(id string, name string, isPublic bool) (GroupCreateResponse, er
 		IsPublic: isPublic,
 	}
 
-	jsonPayload, err := json.Marshal(payload)
-
-	if err != nil {
-		return GroupCreateResponse{}, errors.Join(err, errors.New("Failed to marshal paylod"))
-	}
-
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files/groups/%s", id)
-	req, err := http.NewRequest("PUT", url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return GroupCreateResponse{}, errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return GroupCreateResponse{}, errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return GroupCreateResponse{}, fmt.Errorf("server Returned an error %d", resp.StatusCode)
-	}
-
 	var response GroupCreateResponse
-
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	err = client.Put(fmt.Sprintf("/v3/files/groups/%s", id), payload, &response)
 	if err != nil {
 		return GroupCreateResponse{}, err
 	}
-	formattedJSON, err := json.MarshalIndent(response.Data, "", "    ")
+	err = render(response.Data, response.Data)
 	if err != nil {
-		return GroupCreateResponse{}, errors.New("failed to format JSON")
+		return GroupCreateResponse{}, err
 	}
 
-	fmt.Println(string(formattedJSON))
-
 	return response, nil
 
 }
 
 func DeleteGroup(id string) error {
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return err
 	}
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files/groups/%s", id)
-
-	req, err := http.NewRequest("DELETE", url, nil)
-	if err != nil {
-		return errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	err = client.Delete(fmt.Sprintf("/v3/files/groups/%s", id))
 	if err != nil {
-		return errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("server Returned an error %d, check CID", resp.StatusCode)
+		return err
 	}
 
 	fmt.Println("Group Deleted")
@@ -252,29 +132,14 @@ func DeleteGroup(id string) error {
 }
 
 func AddFile(groupId string, fileId string) error {
-
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return err
 	}
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files/groups/%s/ids/%s", groupId, fileId)
 
-	req, err := http.NewRequest("PUT", url, nil)
+	err = client.Put(fmt.Sprintf("/v3/files/groups/%s/ids/%s", groupId, fileId), nil, nil)
 	if err != nil {
-		return errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("server Returned an error %d, check CID", resp.StatusCode)
+		return err
 	}
 
 	fmt.Println("File added to group")
@@ -283,29 +148,14 @@ func AddFile(groupId string, fileId string) error {
 }
 
 func RemoveFile(groupId string, fileId string) error {
-
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return err
 	}
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/files/groups/%s/ids/%s", groupId, fileId)
 
-	req, err := http.NewRequest("DELETE", url, nil)
+	err = client.Delete(fmt.Sprintf("/v3/files/groups/%s/ids/%s", groupId, fileId))
 	if err != nil {
-		return errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("server Returned an error %d, check CID", resp.StatusCode)
+		return err
 	}
 
 	fmt.Println("File removed from group")
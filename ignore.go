@@ -0,0 +1,185 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+
+	ignore "github.com/sabhiram/go-gitignore"
+	"github.com/urfave/cli/v2"
+)
+
+const ignoreFileName = ".pinataignore"
+
+// PathFilter selects which files of a folder are uploaded. Patterns use the
+// gitignore syntax and are matched against paths relative to the folder.
+type PathFilter struct {
+	// Exclude skips the files matching any of the patterns
+	Exclude []string
+	// Include uploads the files matching any of the patterns even if they
+	// are excluded, ignored or hidden
+	Include []string
+	// SkipHidden skips files and folders whose name starts with a dot
+	SkipHidden bool
+	// GitIgnore also reads .gitignore files, along with .pinataignore files
+	// which are always read
+	GitIgnore bool
+}
+
+// filterFlags are the flags of the commands that read folders
+func filterFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringSliceFlag{
+			Name:  "exclude",
+			Usage: "Skip files in folders matching a gitignore style pattern, can be repeated",
+		},
+		&cli.StringSliceFlag{
+			Name:  "include",
+			Usage: "Include files in folders matching a gitignore style pattern even if they are excluded, ignored or hidden, can be repeated",
+		},
+		&cli.BoolFlag{
+			Name:  "gitignore",
+			Usage: "Skip files ignored by .gitignore files and the .git folder, .pinataignore files are always read",
+		},
+		&cli.BoolFlag{
+			Name:  "skip-hidden",
+			Usage: "Skip files and folders whose name starts with a dot",
+		},
+	}
+}
+
+func pathFilter(ctx *cli.Context) PathFilter {
+	return PathFilter{
+		Exclude:    ctx.StringSlice("exclude"),
+		Include:    ctx.StringSlice("include"),
+		SkipHidden: ctx.Bool("skip-hidden"),
+		GitIgnore:  ctx.Bool("gitignore"),
+	}
+}
+
+type ignoreFile struct {
+	dir     string
+	matcher *ignore.GitIgnore
+}
+
+// pathMatcher applies a PathFilter while a folder is walked, collecting the
+// ignore files of each folder as it is entered
+type pathMatcher struct {
+	filter      PathFilter
+	exclude     *ignore.GitIgnore
+	include     *ignore.GitIgnore
+	ignoreFiles []ignoreFile
+}
+
+func newPathMatcher(filter PathFilter) *pathMatcher {
+	m := &pathMatcher{filter: filter}
+	exclude := filter.Exclude
+	if filter.GitIgnore {
+		exclude = append([]string{".git/"}, exclude...)
+	}
+	if len(exclude) > 0 {
+		m.exclude = ignore.CompileIgnoreLines(exclude...)
+	}
+	if len(filter.Include) > 0 {
+		m.include = ignore.CompileIgnoreLines(filter.Include...)
+	}
+	return m
+}
+
+// enterDir reads the ignore files of a folder, rel is its path relative to
+// the folder being uploaded
+func (m *pathMatcher) enterDir(dir string, rel string) error {
+	names := []string{ignoreFileName}
+	if m.filter.GitIgnore {
+		names = append(names, ".gitignore")
+	}
+	for _, name := range names {
+		matcher, err := ignore.CompileIgnoreFile(filepath.Join(dir, name))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return err
+		}
+		m.ignoreFiles = append(m.ignoreFiles, ignoreFile{dir: filepath.ToSlash(rel), matcher: matcher})
+	}
+	return nil
+}
+
+func (m *pathMatcher) excluded(p string) bool {
+	if m.filter.SkipHidden {
+		for _, part := range strings.Split(strings.TrimSuffix(p, "/"), "/") {
+			if strings.HasPrefix(part, ".") {
+				return true
+			}
+		}
+	}
+	if m.exclude != nil && m.exclude.MatchesPath(p) {
+		return true
+	}
+	for _, f := range m.ignoreFiles {
+		sub := p
+		if f.dir != "." {
+			if !strings.HasPrefix(p, f.dir+"/") {
+				continue
+			}
+			sub = strings.TrimPrefix(p, f.dir+"/")
+		}
+		if f.matcher.MatchesPath(sub) {
+			return true
+		}
+	}
+	return false
+}
+
+// skipDir reports whether nothing in a folder can be uploaded. Folders are
+// only skipped when there are no include patterns that could match inside.
+func (m *pathMatcher) skipDir(rel string) bool {
+	return m.include == nil && m.excluded(filepath.ToSlash(rel)+"/")
+}
+
+func (m *pathMatcher) includeFile(rel string) bool {
+	if filepath.Base(rel) == ignoreFileName {
+		return false
+	}
+	p := filepath.ToSlash(rel)
+	if m.include != nil && m.include.MatchesPath(p) {
+		return true
+	}
+	return !m.excluded(p)
+}
+
+// matcherAt returns a matcher that has entered the folders from root down to
+// dir, or nil if pathsFinder would skip one of them
+func matcherAt(root string, dir string, filter PathFilter) (*pathMatcher, error) {
+	m := newPathMatcher(filter)
+	err := m.enterDir(root, ".")
+	if err != nil {
+		return nil, err
+	}
+	if dir == "." {
+		return m, nil
+	}
+	rel := "."
+	for _, part := range strings.Split(filepath.ToSlash(dir), "/") {
+		rel = filepath.Join(rel, part)
+		if m.skipDir(rel) {
+			return nil, nil
+		}
+		err = m.enterDir(filepath.Join(root, rel), rel)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return m, nil
+}
+
+// filterMatches reports whether pathsFinder would find the file at rel inside
+// root
+func filterMatches(root string, rel string, filter PathFilter) (bool, error) {
+	m, err := matcherAt(root, filepath.Dir(rel), filter)
+	if err != nil || m == nil {
+		return false, err
+	}
+	return m.includeFile(rel), nil
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestPathFilter(t *testing.T) {
+	root := t.TempDir()
+	tree := map[string]string{
+		".pinataignore":     "*.log\n!keep.log\nbuild/\n",
+		".gitignore":        "secret.txt\n",
+		".env":              "",
+		".git/config":       "",
+		"a.log":             "",
+		"keep.log":          "",
+		"secret.txt":        "",
+		"x.tmp":             "",
+		"build/out.js":      "",
+		"src/build.js":      "",
+		"src/debug.log":     "",
+		"src/keep.log":      "",
+		"src/.pinataignore": "*.tmp\n",
+		"src/x.tmp":         "",
+		"src/lib/y.tmp":     "",
+		"docs/.gitignore":   "draft.md\n",
+		"docs/draft.md":     "",
+		"docs/index.md":     "",
+	}
+	for name, data := range tree {
+		path := filepath.Join(root, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(data), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter PathFilter
+		want   []string
+	}{
+		{
+			// Negated patterns keep files, folder patterns skip the folder
+			// but not files of the same name, and nested .pinataignore
+			// files only apply below their folder
+			name:   ".pinataignore",
+			filter: PathFilter{},
+			want: []string{
+				".env", ".git/config", ".gitignore", "docs/.gitignore", "docs/draft.md", "docs/index.md",
+				"keep.log", "secret.txt", "src/build.js", "src/keep.log", "x.tmp",
+			},
+		},
+		{
+			name:   "gitignore",
+			filter: PathFilter{GitIgnore: true},
+			want: []string{
+				".env", ".gitignore", "docs/.gitignore", "docs/index.md",
+				"keep.log", "src/build.js", "src/keep.log", "x.tmp",
+			},
+		},
+		{
+			name:   "exclude",
+			filter: PathFilter{GitIgnore: true, Exclude: []string{"*.md", "!index.md", "src/"}},
+			want: []string{
+				".env", ".gitignore", "docs/.gitignore", "docs/index.md", "keep.log", "x.tmp",
+			},
+		},
+		{
+			name:   "skip hidden",
+			filter: PathFilter{SkipHidden: true},
+			want: []string{
+				"docs/draft.md", "docs/index.md", "keep.log", "secret.txt", "src/build.js", "src/keep.log", "x.tmp",
+			},
+		},
+		{
+			// Include patterns win over everything else
+			name:   "include",
+			filter: PathFilter{SkipHidden: true, GitIgnore: true, Include: []string{".env", "build/", "src/*.tmp"}},
+			want: []string{
+				".env", "build/out.js", "docs/index.md", "keep.log", "src/build.js", "src/keep.log", "src/x.tmp", "x.tmp",
+			},
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stats, err := os.Stat(root)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files, err := pathsFinder(root, stats, test.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for _, f := range files {
+				rel, _ := filepath.Rel(root, f)
+				got = append(got, filepath.ToSlash(rel))
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %q, want %q", got, test.want)
+			}
+
+			// filterMatches agrees with the walk for every file
+			found := map[string]bool{}
+			for _, p := range got {
+				found[p] = true
+			}
+			for name := range tree {
+				matches, err := filterMatches(root, filepath.FromSlash(name), test.filter)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if matches != found[name] {
+					t.Errorf("filterMatches(%q) = %t, but the walk found it: %t", name, matches, found[name])
+				}
+			}
+		})
+	}
+}
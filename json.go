@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/mattn/go-isatty"
+)
+
+// readJSONInput reads a JSON document from the argument, a file or stdin,
+// in that order
+func readJSONInput(arg string, file string) ([]byte, string, error) {
+	switch {
+	case arg != "" && arg != "-" && file != "":
+		return nil, "", errors.New("provide the JSON as an argument or with --file, not both")
+	case arg != "" && arg != "-":
+		return []byte(arg), "", nil
+	case file != "":
+		data, err := os.ReadFile(file)
+		return data, filepath.Base(file), err
+	case arg == "-" || !isatty.IsTerminal(os.Stdin.Fd()) && !isatty.IsCygwinTerminal(os.Stdin.Fd()):
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, "", errors.Join(err, errors.New("failed to read stdin"))
+		}
+		return data, "", nil
+	}
+	return nil, "", errors.New("no JSON provided, pass it as an argument, with --file or through stdin")
+}
+
+// canonicalJSON re-encodes a document without whitespace and with object
+// keys sorted, keeping numbers as they were written
+func canonicalJSON(data []byte) ([]byte, error) {
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.UseNumber()
+	var value interface{}
+	err := decoder.Decode(&value)
+	if err != nil {
+		return nil, err
+	}
+
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	err = encoder.Encode(value)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), nil
+}
+
+// UploadJSON validates a JSON document and uploads it as application/json.
+// A Name of "nil" uses the name of the file it was read from, or data.json.
+func UploadJSON(arg string, file string, canonicalize bool, options UploadOptions) (UploadResponse, error) {
+	data, fileName, err := readJSONInput(arg, file)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+
+	if !json.Valid(data) {
+		var value interface{}
+		err = json.Unmarshal(data, &value)
+		return UploadResponse{}, fmt.Errorf("invalid JSON: %w", err)
+	}
+	if canonicalize {
+		data, err = canonicalJSON(data)
+		if err != nil {
+			return UploadResponse{}, fmt.Errorf("invalid JSON: %w", err)
+		}
+	}
+
+	if options.Name == "nil" {
+		options.Name = "data.json"
+		if fileName != "" {
+			options.Name = fileName
+		}
+	}
+	options.MimeType = "application/json"
+
+	var response UploadResponse
+	if int64(len(data)) > int64(settingInt("upload_threshold")) {
+		response, err = uploadStream(bytes.NewReader(data), options)
+	} else {
+		response, err = uploadBytes(data, options)
+	}
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	if options.Verify {
+		local, err := readerCID(bytes.NewReader(data))
+		if err != nil {
+			return UploadResponse{}, err
+		}
+		err = verifyCID(options.Name, local, response)
+		if err != nil {
+			return response, err
+		}
+	}
+
+	err = render(response.Data, response.Data)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+
+	return response, nil
+}
@@ -1,83 +1,53 @@
 package main
 
 import (
-	"bytes"
-	"encoding/json"
-	"errors"
 	"fmt"
-	"net/http"
-	"strings"
+	"net/url"
 )
 
 func ListKeys(name string, revoked bool, limitedUse bool, exhausted bool, offset string) (KeyListResponse, error) {
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return KeyListResponse{}, err
 	}
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/pinata/keys?")
 
-	params := []string{}
+	params := url.Values{}
 
 	if name != "" {
-		params = append(params, "name="+name)
+		params.Set("name", name)
 	}
 
 	if revoked {
-		params = append(params, "revoked=true")
+		params.Set("revoked", "true")
 	}
 
 	if limitedUse {
-		params = append(params, "limitedUse=true")
+		params.Set("limitedUse", "true")
 	}
 
 	if exhausted {
-		params = append(params, "exhausted=true")
+		params.Set("exhausted", "true")
 	}
 	if offset != "" {
-		params = append(params, "offset="+offset)
-	}
-
-	if len(params) > 0 {
-		url += strings.Join(params, "&")
-	}
-
-	req, err := http.NewRequest("GET", url, nil)
-	if err != nil {
-		return KeyListResponse{}, errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return KeyListResponse{}, errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return KeyListResponse{}, fmt.Errorf("server Returned an error %d", resp.StatusCode)
+		params.Set("offset", offset)
 	}
 
 	var response KeyListResponse
-
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	err = client.Get("/v3/pinata/keys", params, &response)
 	if err != nil {
 		return KeyListResponse{}, err
 	}
-	formattedJSON, err := json.MarshalIndent(response, "", "    ")
+	err = render(response, response.Keys)
 	if err != nil {
-		return KeyListResponse{}, errors.New("failed to format JSON")
+		return KeyListResponse{}, err
 	}
 
-	fmt.Println(string(formattedJSON))
-
 	return response, nil
 
 }
 
 func CreateKey(name string, admin bool, uses int, endpoints []string) (CreateKeyResponse, error) {
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return CreateKeyResponse{}, err
 	}
@@ -129,71 +99,29 @@ func CreateKey(name string, admin bool, uses int, endpoints []string) (CreateKey
 		}
 	}
 
-	jsonPayload, err := json.Marshal(payload)
-
-	if err != nil {
-		return CreateKeyResponse{}, errors.Join(err, errors.New("Failed to marshal paylod"))
-	}
-
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/pinata/keys")
-	req, err := http.NewRequest("POST", url, bytes.NewBuffer(jsonPayload))
-	if err != nil {
-		return CreateKeyResponse{}, errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
-
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return CreateKeyResponse{}, errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return CreateKeyResponse{}, fmt.Errorf("server Returned an error %d", resp.StatusCode)
-	}
-
 	var response CreateKeyResponse
-
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	err = client.Post("/v3/pinata/keys", payload, &response)
 	if err != nil {
 		return CreateKeyResponse{}, err
 	}
-	formattedJSON, err := json.MarshalIndent(response, "", "    ")
+	err = render(response, response)
 	if err != nil {
-		return CreateKeyResponse{}, errors.New("failed to format JSON")
+		return CreateKeyResponse{}, err
 	}
 
-	fmt.Println(string(formattedJSON))
-
 	return response, nil
 
 }
 
 func RevokeKey(id string) error {
-	jwt, err := findToken()
+	client, err := NewClient()
 	if err != nil {
 		return err
 	}
-	url := fmt.Sprintf("https://api.pinata.cloud/v3/pinata/keys/%s", id)
-
-	req, err := http.NewRequest("PUT", url, nil)
-	if err != nil {
-		return errors.Join(err, errors.New("failed to create the request"))
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", "application/json")
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
+	err = client.Put(fmt.Sprintf("/v3/pinata/keys/%s", id), nil, nil)
 	if err != nil {
-		return errors.Join(err, errors.New("failed to send the request"))
-	}
-	defer resp.Body.Close()
-
-	if resp.StatusCode != 200 {
-		return fmt.Errorf("server Returned an error %d, check CID", resp.StatusCode)
+		return err
 	}
 
 	fmt.Println("Key Revoked")
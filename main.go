@@ -6,6 +6,7 @@ import (
 	"os"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/urfave/cli/v2"
 )
@@ -14,28 +15,233 @@ func main() {
 	app := &cli.App{
 		Name:  "pinata",
 		Usage: "A CLI for uploading files to Pinata! To get started make an API key at https://app.pinata.cloud/keys, then authorize the CLI with the auth command with your JWT",
+		Flags: append([]cli.Flag{
+			&cli.StringFlag{
+				Name:    "profile",
+				Usage:   "Name of the profile to use instead of the current one",
+				EnvVars: []string{"PINATA_PROFILE"},
+			},
+			&cli.IntFlag{
+				Name:    "retries",
+				Value:   3,
+				Usage:   "Number of times to retry a request that failed with a network error, 429 or 5xx",
+				EnvVars: []string{"PINATA_RETRIES"},
+			},
+			&cli.DurationFlag{
+				Name:    "retry-max-backoff",
+				Value:   30 * time.Second,
+				Usage:   "Longest time to wait between retries",
+				EnvVars: []string{"PINATA_RETRY_MAX_BACKOFF"},
+			},
+			&cli.BoolFlag{
+				Name:    "retry-jitter",
+				Value:   true,
+				Usage:   "Randomize the wait between retries, disable with --retry-jitter=false",
+				EnvVars: []string{"PINATA_RETRY_JITTER"},
+			},
+		}, outputFlags()...),
+		Before: func(ctx *cli.Context) error {
+			err := applyOutputFlags(ctx)
+			if err != nil {
+				return err
+			}
+			profileFlag = ctx.String("profile")
+			retryPolicy = RetryPolicy{
+				MaxRetries: settingInt("retries"),
+				MaxBackoff: settingDuration("retry_max_backoff"),
+				Jitter:     settingBool("retry_jitter"),
+			}
+			if ctx.IsSet("retries") {
+				retryPolicy.MaxRetries = ctx.Int("retries")
+			}
+			if ctx.IsSet("retry-max-backoff") {
+				retryPolicy.MaxBackoff = ctx.Duration("retry-max-backoff")
+			}
+			if ctx.IsSet("retry-jitter") {
+				retryPolicy.Jitter = ctx.Bool("retry-jitter")
+			}
+			return nil
+		},
 		Commands: []*cli.Command{
 			{
 				Name:      "auth",
 				Aliases:   []string{"a"},
 				Usage:     "Authorize the CLI with your Pinata JWT",
-				ArgsUsage: "[your Pinata JWT]",
+				ArgsUsage: "[your Pinata JWT, or - to read it from stdin]",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:  "gateway",
+						Usage: "Set the default gateway domain instead of choosing one from a list",
+					},
+					&cli.StringFlag{
+						Name:  "group",
+						Usage: "Set a default group ID for uploads with this profile",
+					},
+					&cli.StringFlag{
+						Name:  "api-host",
+						Usage: "Set the API host used with this profile",
+					},
+					&cli.StringFlag{
+						Name:  "uploads-host",
+						Usage: "Set the uploads host used with this profile",
+					},
+				},
 				Action: func(ctx *cli.Context) error {
-					err := SaveJWT()
+					jwt := ctx.Args().First()
+					settings := Profile{
+						Gateway:     ctx.String("gateway"),
+						Group:       ctx.String("group"),
+						APIHost:     ctx.String("api-host"),
+						UploadsHost: ctx.String("uploads-host"),
+					}
+					err := SaveJWT(jwt, settings)
 					return err
 				},
+				Subcommands: []*cli.Command{
+					withOutput(&cli.Command{
+						Name:    "status",
+						Aliases: []string{"s"},
+						Usage:   "Check the saved JWT and show the account and key it belongs to",
+						Action: func(ctx *cli.Context) error {
+							_, err := AuthStatus()
+							return err
+						},
+					}),
+					{
+						Name:  "logout",
+						Usage: "Remove the JWT saved for the active profile",
+						Action: func(ctx *cli.Context) error {
+							err := Logout()
+							return err
+						},
+					},
+				},
 			},
+			withOutput(&cli.Command{
+				Name:  "whoami",
+				Usage: "Alias for auth status",
+				Action: func(ctx *cli.Context) error {
+					_, err := AuthStatus()
+					return err
+				},
+			}),
 			{
+				Name:    "profiles",
+				Aliases: []string{"p"},
+				Usage:   "Manage named profiles for multiple Pinata accounts",
+				Subcommands: []*cli.Command{
+					withOutput(&cli.Command{
+						Name:    "list",
+						Aliases: []string{"l"},
+						Usage:   "List saved profiles",
+						Action: func(ctx *cli.Context) error {
+							_, err := ListProfiles()
+							return err
+						},
+					}),
+					{
+						Name:      "use",
+						Aliases:   []string{"u"},
+						Usage:     "Set the profile used by default",
+						ArgsUsage: "[name of profile]",
+						Action: func(ctx *cli.Context) error {
+							name := ctx.Args().First()
+							if name == "" {
+								return errors.New("no profile name provided")
+							}
+							err := UseProfile(name)
+							return err
+						},
+					},
+					{
+						Name:      "remove",
+						Aliases:   []string{"r"},
+						Usage:     "Remove a profile and its credentials",
+						ArgsUsage: "[name of profile]",
+						Action: func(ctx *cli.Context) error {
+							name := ctx.Args().First()
+							if name == "" {
+								return errors.New("no profile name provided")
+							}
+							err := RemoveProfile(name)
+							return err
+						},
+					},
+				},
+			},
+			{
+				Name:    "config",
+				Aliases: []string{"c"},
+				Usage:   "Inspect and edit settings in the config file",
+				Subcommands: []*cli.Command{
+					withOutput(&cli.Command{
+						Name:    "list",
+						Aliases: []string{"l"},
+						Usage:   "List every setting with its value and where it came from",
+						Action: func(ctx *cli.Context) error {
+							_, err := ConfigList()
+							return err
+						},
+					}),
+					{
+						Name:      "get",
+						Aliases:   []string{"g"},
+						Usage:     "Print the value of a setting",
+						ArgsUsage: "[key]",
+						Action: func(ctx *cli.Context) error {
+							key := ctx.Args().First()
+							if key == "" {
+								return errors.New("no key provided")
+							}
+							_, err := ConfigGet(key)
+							return err
+						},
+					},
+					{
+						Name:      "set",
+						Aliases:   []string{"s"},
+						Usage:     "Save a setting to the config file",
+						ArgsUsage: "[key] [value]",
+						Action: func(ctx *cli.Context) error {
+							key := ctx.Args().First()
+							value := ctx.Args().Get(1)
+							if key == "" {
+								return errors.New("no key provided")
+							}
+							if value == "" {
+								return errors.New("no value provided")
+							}
+							err := ConfigSet(key, value)
+							return err
+						},
+					},
+					{
+						Name:      "unset",
+						Aliases:   []string{"u"},
+						Usage:     "Remove a setting from the config file",
+						ArgsUsage: "[key]",
+						Action: func(ctx *cli.Context) error {
+							key := ctx.Args().First()
+							if key == "" {
+								return errors.New("no key provided")
+							}
+							err := ConfigUnset(key)
+							return err
+						},
+					},
+				},
+			},
+			withOutput(&cli.Command{
 				Name:      "upload",
 				Aliases:   []string{"u"},
 				Usage:     "Upload a file to Pinata",
-				ArgsUsage: "[path to file]",
-				Flags: []cli.Flag{
+				ArgsUsage: "[path to file or glob]... or - to read from stdin",
+				Flags: append([]cli.Flag{
 					&cli.StringFlag{
 						Name:    "group",
 						Aliases: []string{"g"},
 						Value:   "",
-						Usage:   "Upload a file to a specific group by passing in the groupId",
+						Usage:   "Upload a file to a specific group by passing in the groupId, defaults to the profile's group",
 					},
 					&cli.StringFlag{
 						Name:    "name",
@@ -47,25 +253,362 @@ func main() {
 						Name:  "verbose",
 						Usage: "Show upload progress",
 					},
-				},
+					&cli.StringSliceFlag{
+						Name:    "keyvalue",
+						Aliases: []string{"kv"},
+						Usage:   "Add a metadata keyvalue to the upload, can be repeated (format: key=value)",
+					},
+					&cli.StringFlag{
+						Name:  "keyvalues-file",
+						Usage: "Read metadata keyvalues from a JSON object in a file, --keyvalue takes precedence",
+					},
+					&cli.StringFlag{
+						Name:  "mime",
+						Usage: "MIME type of the content when uploading from stdin (default: application/octet-stream)",
+					},
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Usage: "Number of paths uploaded at the same time when uploading several, defaults to the upload_concurrency setting",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "List the files that would be uploaded, how and with which metadata, without uploading anything",
+					},
+					&cli.BoolFlag{
+						Name:  "verify",
+						Usage: "Compute the CID locally and fail if it differs from the CID of the upload",
+					},
+					&cli.BoolFlag{
+						Name:  "skip-existing",
+						Usage: "Don't upload content whose CID is already on the account, the existing file is added to the group instead",
+					},
+					&cli.StringFlag{
+						Name:  "manifest",
+						Usage: "Write the path, id, CID, size, MIME type, group and gateway URL of each upload to a file, as CSV if it ends with .csv and JSON otherwise",
+					},
+				}, filterFlags()...),
 				Action: func(ctx *cli.Context) error {
-					filePath := ctx.Args().First()
+					paths := ctx.Args().Slice()
 					groupId := ctx.String("group")
 					name := ctx.String("name")
 					verbose := ctx.Bool("verbose")
-					if filePath == "" {
+					if len(paths) == 0 {
+						return errors.New("no file path provided")
+					}
+					if err := checkPathArgs(paths); err != nil {
+						return err
+					}
+					if groupId == "" {
+						groupId = activeProfile().Group
+					}
+					keyvalues, err := parseKeyValues(ctx.StringSlice("keyvalue"), ctx.String("keyvalues-file"))
+					if err != nil {
+						return err
+					}
+					concurrency := settingInt("upload_concurrency")
+					if ctx.IsSet("concurrency") {
+						concurrency = ctx.Int("concurrency")
+					}
+					options := UploadOptions{
+						GroupId:      groupId,
+						Name:         name,
+						KeyValues:    keyvalues,
+						MimeType:     ctx.String("mime"),
+						Filter:       pathFilter(ctx),
+						Verify:       ctx.Bool("verify"),
+						SkipExisting: ctx.Bool("skip-existing"),
+						Verbose:      verbose,
+					}
+					if ctx.Bool("dry-run") {
+						_, err = PlanUploads(paths, options)
+						return err
+					}
+					results, err := UploadPaths(paths, options, concurrency)
+					return withManifest(ctx.String("manifest"), results, groupId, err)
+				},
+			}),
+			withOutput(&cli.Command{
+				Name:      "upload-json",
+				Usage:     "Upload a JSON document given as an argument, a file or through stdin",
+				ArgsUsage: "[JSON] or - to read from stdin",
+				Flags: []cli.Flag{
+					&cli.StringFlag{
+						Name:    "file",
+						Aliases: []string{"f"},
+						Usage:   "Read the JSON from a file",
+					},
+					&cli.BoolFlag{
+						Name:  "canonicalize",
+						Usage: "Remove whitespace and sort object keys before uploading",
+					},
+					&cli.StringFlag{
+						Name:    "group",
+						Aliases: []string{"g"},
+						Usage:   "Upload the document to a specific group by passing in the groupId, defaults to the profile's group",
+					},
+					&cli.StringFlag{
+						Name:    "name",
+						Aliases: []string{"n"},
+						Value:   "nil",
+						Usage:   "Add a name for the document. By default it will use the name of the file or data.json",
+					},
+					&cli.StringSliceFlag{
+						Name:    "keyvalue",
+						Aliases: []string{"kv"},
+						Usage:   "Add a metadata keyvalue to the upload, can be repeated (format: key=value)",
+					},
+					&cli.StringFlag{
+						Name:  "keyvalues-file",
+						Usage: "Read metadata keyvalues from a JSON object in a file, --keyvalue takes precedence",
+					},
+					&cli.BoolFlag{
+						Name:  "verify",
+						Usage: "Compute the CID locally and fail if it differs from the CID of the upload",
+					},
+					&cli.BoolFlag{
+						Name:  "verbose",
+						Usage: "Show upload progress",
+					},
+					&cli.StringFlag{
+						Name:  "manifest",
+						Usage: "Write the path, id, CID, size, MIME type, group and gateway URL of the upload to a file, as CSV if it ends with .csv and JSON otherwise",
+					},
+				},
+				Action: func(ctx *cli.Context) error {
+					groupId := ctx.String("group")
+					if groupId == "" {
+						groupId = activeProfile().Group
+					}
+					keyvalues, err := parseKeyValues(ctx.StringSlice("keyvalue"), ctx.String("keyvalues-file"))
+					if err != nil {
+						return err
+					}
+					arg := ctx.Args().First()
+					response, err := UploadJSON(arg, ctx.String("file"), ctx.Bool("canonicalize"), UploadOptions{
+						GroupId:   groupId,
+						Name:      ctx.String("name"),
+						KeyValues: keyvalues,
+						Verify:    ctx.Bool("verify"),
+						Verbose:   ctx.Bool("verbose"),
+					})
+					// The document is listed by the file it was read
+					// from, - for stdin and no path for an argument
+					path := ctx.String("file")
+					if path == "" && (arg == "" || arg == "-") {
+						path = "-"
+					}
+					result := uploadResult(path, response)
+					if err != nil {
+						result.Error = err.Error()
+					}
+					return withManifest(ctx.String("manifest"), []UploadResult{result}, groupId, err)
+				},
+			}),
+			withOutput(&cli.Command{
+				Name:      "cid",
+				Usage:     "Compute the CID of files or folders without uploading them",
+				ArgsUsage: "[path to file or glob]... or - to read from stdin",
+				Flags:     filterFlags(),
+				Action: func(ctx *cli.Context) error {
+					paths := ctx.Args().Slice()
+					if len(paths) == 0 {
 						return errors.New("no file path provided")
 					}
-					_, err := Upload(filePath, groupId, name, verbose)
+					if err := checkPathArgs(paths); err != nil {
+						return err
+					}
+					_, err := ComputeCIDs(paths, pathFilter(ctx))
 					return err
 				},
+			}),
+			withOutput(&cli.Command{
+				Name:      "sync",
+				Usage:     "Mirror the files of a folder into a group, uploading new and changed files",
+				ArgsUsage: "[path to folder]",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:    "group",
+						Aliases: []string{"g"},
+						Usage:   "Group to sync the folder to, defaults to the profile's group",
+					},
+					&cli.BoolFlag{
+						Name:  "delete",
+						Usage: "Delete the files of the group that aren't in the folder and the previous versions of updated files",
+					},
+					&cli.BoolFlag{
+						Name:  "dry-run",
+						Usage: "Print the plan without applying it",
+					},
+					&cli.StringSliceFlag{
+						Name:    "keyvalue",
+						Aliases: []string{"kv"},
+						Usage:   "Add a metadata keyvalue to the uploaded files, can be repeated (format: key=value)",
+					},
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Usage: "Number of files uploaded or deleted at the same time, defaults to the upload_concurrency setting",
+					},
+				}, filterFlags()...),
+				Action: func(ctx *cli.Context) error {
+					root := ctx.Args().First()
+					if root == "" {
+						return errors.New("no folder provided")
+					}
+					if err := checkPathArgs(ctx.Args().Slice()); err != nil {
+						return err
+					}
+					groupId := ctx.String("group")
+					if groupId == "" {
+						groupId = activeProfile().Group
+					}
+					keyvalues, err := parseKeyValues(ctx.StringSlice("keyvalue"), "")
+					if err != nil {
+						return err
+					}
+					concurrency := settingInt("upload_concurrency")
+					if ctx.IsSet("concurrency") {
+						concurrency = ctx.Int("concurrency")
+					}
+					_, err = SyncFolder(root, SyncOptions{
+						GroupId:     groupId,
+						KeyValues:   keyvalues,
+						Filter:      pathFilter(ctx),
+						Delete:      ctx.Bool("delete"),
+						DryRun:      ctx.Bool("dry-run"),
+						Concurrency: concurrency,
+					})
+					return err
+				},
+			}),
+			withOutput(&cli.Command{
+				Name:      "watch",
+				Usage:     "Upload the files of a folder as they appear or change, until interrupted",
+				ArgsUsage: "[path to folder]",
+				Flags: append([]cli.Flag{
+					&cli.StringFlag{
+						Name:    "group",
+						Aliases: []string{"g"},
+						Usage:   "Upload the files to a specific group by passing in the groupId, defaults to the profile's group",
+					},
+					&cli.StringSliceFlag{
+						Name:    "keyvalue",
+						Aliases: []string{"kv"},
+						Usage:   "Add a metadata keyvalue to the uploaded files, can be repeated (format: key=value)",
+					},
+					&cli.StringFlag{
+						Name:  "keyvalues-file",
+						Usage: "Read metadata keyvalues from a JSON object in a file, --keyvalue takes precedence",
+					},
+					&cli.DurationFlag{
+						Name:  "debounce",
+						Value: 2 * time.Second,
+						Usage: "How long a file must stay unchanged before it's uploaded",
+					},
+					&cli.BoolFlag{
+						Name:  "poll",
+						Usage: "Scan the folder periodically instead of using file notifications",
+					},
+					&cli.DurationFlag{
+						Name:  "poll-interval",
+						Value: 5 * time.Second,
+						Usage: "Time between scans when polling",
+					},
+					&cli.IntFlag{
+						Name:  "concurrency",
+						Usage: "Number of files uploaded at the same time, defaults to the upload_concurrency setting",
+					},
+					&cli.StringFlag{
+						Name:  "state",
+						Usage: "File recording the uploaded files, defaults to a file in the config folder for the folder, profile and group",
+					},
+				}, filterFlags()...),
+				Action: func(ctx *cli.Context) error {
+					root := ctx.Args().First()
+					if root == "" {
+						return errors.New("no folder provided")
+					}
+					if err := checkPathArgs(ctx.Args().Slice()); err != nil {
+						return err
+					}
+					groupId := ctx.String("group")
+					if groupId == "" {
+						groupId = activeProfile().Group
+					}
+					keyvalues, err := parseKeyValues(ctx.StringSlice("keyvalue"), ctx.String("keyvalues-file"))
+					if err != nil {
+						return err
+					}
+					concurrency := settingInt("upload_concurrency")
+					if ctx.IsSet("concurrency") {
+						concurrency = ctx.Int("concurrency")
+					}
+					return WatchFolder(root, WatchOptions{
+						GroupId:      groupId,
+						KeyValues:    keyvalues,
+						Filter:       pathFilter(ctx),
+						Debounce:     ctx.Duration("debounce"),
+						Poll:         ctx.Bool("poll"),
+						PollInterval: ctx.Duration("poll-interval"),
+						Concurrency:  concurrency,
+						StatePath:    ctx.String("state"),
+					})
+				},
+			}),
+			{
+				Name:  "uploads",
+				Usage: "Manage interrupted uploads that can be resumed",
+				Subcommands: []*cli.Command{
+					withOutput(&cli.Command{
+						Name:    "list",
+						Aliases: []string{"l"},
+						Usage:   "List uploads that haven't finished",
+						Action: func(ctx *cli.Context) error {
+							_, err := ListUploads()
+							return err
+						},
+					}),
+					withOutput(&cli.Command{
+						Name:      "resume",
+						Aliases:   []string{"r"},
+						Usage:     "Resume an interrupted upload",
+						ArgsUsage: "[upload ID or path to file]",
+						Flags: []cli.Flag{
+							&cli.BoolFlag{
+								Name:  "verbose",
+								Usage: "Show upload progress",
+							},
+						},
+						Action: func(ctx *cli.Context) error {
+							ref := ctx.Args().First()
+							if ref == "" {
+								return errors.New("no upload ID provided")
+							}
+							_, err := ResumeUpload(ref, ctx.Bool("verbose"))
+							return err
+						},
+					}),
+					{
+						Name:      "abort",
+						Aliases:   []string{"a"},
+						Usage:     "Cancel an interrupted upload and remove it from the server",
+						ArgsUsage: "[upload ID or path to file]",
+						Action: func(ctx *cli.Context) error {
+							ref := ctx.Args().First()
+							if ref == "" {
+								return errors.New("no upload ID provided")
+							}
+							err := AbortUpload(ref)
+							return err
+						},
+					},
+				},
 			},
 			{
 				Name:    "groups",
 				Aliases: []string{"g"},
 				Usage:   "Interact with file groups",
 				Subcommands: []*cli.Command{
-					{
+					withOutput(&cli.Command{
 						Name:      "create",
 						Aliases:   []string{"c"},
 						Usage:     "Create a new group",
@@ -87,8 +630,8 @@ func main() {
 							_, err := CreateGroup(name, public)
 							return err
 						},
-					},
-					{
+					}),
+					withOutput(&cli.Command{
 						Name:    "list",
 						Aliases: []string{"l"},
 						Usage:   "List groups on your account",
@@ -123,8 +666,8 @@ func main() {
 							_, err := ListGroups(amount, public, name, token)
 							return err
 						},
-					},
-					{
+					}),
+					withOutput(&cli.Command{
 						Name:      "update",
 						Aliases:   []string{"u"},
 						Usage:     "Update a group",
@@ -152,7 +695,7 @@ func main() {
 							_, err := UpdateGroup(groupId, name, public)
 							return err
 						},
-					},
+					}),
 					{
 						Name:      "delete",
 						Aliases:   []string{"d"},
@@ -167,7 +710,7 @@ func main() {
 							return err
 						},
 					},
-					{
+					withOutput(&cli.Command{
 						Name:      "get",
 						Aliases:   []string{"g"},
 						Usage:     "Get group info by ID",
@@ -180,7 +723,7 @@ func main() {
 							_, err := GetGroup(groupId)
 							return err
 						},
-					},
+					}),
 					{
 						Name:      "add",
 						Aliases:   []string{"a"},
@@ -238,7 +781,7 @@ func main() {
 							return err
 						},
 					},
-					{
+					withOutput(&cli.Command{
 						Name:      "get",
 						Aliases:   []string{"g"},
 						Usage:     "Get file info by ID",
@@ -251,8 +794,8 @@ func main() {
 							_, err := GetFile(fileId)
 							return err
 						},
-					},
-					{
+					}),
+					withOutput(&cli.Command{
 						Name:      "update",
 						Aliases:   []string{"u"},
 						Usage:     "Update a file by ID",
@@ -263,6 +806,14 @@ func main() {
 								Aliases: []string{"n"},
 								Usage:   "Update the name of a file",
 							},
+							&cli.StringSliceFlag{
+								Name:  "set",
+								Usage: "Add or overwrite a metadata keyvalue, can be repeated (format: key=value)",
+							},
+							&cli.StringSliceFlag{
+								Name:  "unset",
+								Usage: "Remove a metadata keyvalue by key, can be repeated",
+							},
 						},
 						Action: func(ctx *cli.Context) error {
 							fileId := ctx.Args().First()
@@ -270,11 +821,15 @@ func main() {
 							if fileId == "" {
 								return errors.New("no ID provided")
 							}
-							_, err := UpdateFile(fileId, name)
+							set, err := parseKeyValues(ctx.StringSlice("set"), "")
+							if err != nil {
+								return err
+							}
+							_, err = UpdateFile(fileId, name, set, ctx.StringSlice("unset"))
 							return err
 						},
-					},
-					{
+					}),
+					withOutput(&cli.Command{
 						Name:    "list",
 						Aliases: []string{"l"},
 						Usage:   "List most recent files",
@@ -339,7 +894,7 @@ func main() {
 							_, err := ListFiles(amount, token, cidPending, name, cid, group, mime, keyvalues)
 							return err
 						},
-					},
+					}),
 				},
 			},
 			{
@@ -347,7 +902,7 @@ func main() {
 				Aliases: []string{"s"},
 				Usage:   "Interact and manage hot swaps on Pinata",
 				Subcommands: []*cli.Command{
-					{
+					withOutput(&cli.Command{
 						Name:      "list",
 						Aliases:   []string{"l"},
 						Usage:     "List swaps for a given gateway domain or for your config gateway domain",
@@ -361,8 +916,8 @@ func main() {
 							_, err := GetSwapHistory(cid, domain)
 							return err
 						},
-					},
-					{
+					}),
+					withOutput(&cli.Command{
 						Name:      "add",
 						Aliases:   []string{"a"},
 						Usage:     "Add a swap for a CID",
@@ -379,7 +934,7 @@ func main() {
 							_, err := AddSwap(cid, swapCid)
 							return err
 						},
-					},
+					}),
 					{
 						Name:      "delete",
 						Aliases:   []string{"d"},
@@ -439,7 +994,7 @@ func main() {
 							expires := ctx.Args().Get(1)
 
 							if expires == "" {
-								expires = "30"
+								expires = settingString("sign_expires")
 							}
 
 							expiresInt, err := strconv.Atoi(expires)
@@ -457,7 +1012,7 @@ func main() {
 				Aliases: []string{"k"},
 				Usage:   "Create and manage generated API keys",
 				Subcommands: []*cli.Command{
-					{
+					withOutput(&cli.Command{
 						Name:    "create",
 						Aliases: []string{"c"},
 						Usage:   "Create an API key with admin or scoped permissions",
@@ -493,8 +1048,8 @@ func main() {
 							_, err := CreateKey(name, admin, uses, endpoints)
 							return err
 						},
-					},
-					{
+					}),
+					withOutput(&cli.Command{
 						Name:    "list",
 						Aliases: []string{"l"},
 						Usage:   "List and filter API key",
@@ -534,7 +1089,7 @@ func main() {
 							_, err := ListKeys(name, revoked, uses, exhausted, offset)
 							return err
 						},
-					},
+					}),
 					{
 						Name:      "revoke",
 						Aliases:   []string{"r"},
@@ -555,6 +1110,7 @@ func main() {
 	}
 
 	if err := app.Run(os.Args); err != nil {
-		log.Fatal(err)
+		log.Print(err)
+		os.Exit(exitCode(err))
 	}
 }
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// ManifestEntry maps a local path to the file it was uploaded as
+type ManifestEntry struct {
+	Path     string `json:"path"`
+	Id       string `json:"id"`
+	Name     string `json:"name"`
+	Cid      string `json:"cid"`
+	Size     int    `json:"size"`
+	MimeType string `json:"mime_type"`
+	GroupId  string `json:"group_id"`
+	URL      string `json:"url"`
+	Error    string `json:"error,omitempty"`
+}
+
+var manifestColumns = []string{"path", "id", "name", "cid", "size", "mime_type", "group_id", "url", "error"}
+
+// withManifest writes the manifest of results when manifestPath is set, even
+// if uploads failed with err, and returns err along with any error writing it
+func withManifest(manifestPath string, results []UploadResult, groupId string, err error) error {
+	if manifestPath == "" || results == nil {
+		return err
+	}
+	manifestErr := writeManifest(manifestPath, results, groupId)
+	if manifestErr != nil {
+		return errors.Join(err, fmt.Errorf("failed to write manifest: %w", manifestErr))
+	}
+	return err
+}
+
+// writeManifest writes the results of an upload to a file, as CSV when its
+// name ends with .csv and as JSON otherwise. URLs are left empty when the
+// profile has no gateway.
+func writeManifest(manifestPath string, results []UploadResult, groupId string) error {
+	domain, _ := findGatewayDomain()
+
+	entries := make([]ManifestEntry, len(results))
+	for i, result := range results {
+		data := result.response.Data
+		entries[i] = ManifestEntry{
+			Path:     result.Path,
+			Id:       data.Id,
+			Name:     data.Name,
+			Cid:      data.Cid,
+			Size:     data.Size,
+			MimeType: data.MimeType,
+			GroupId:  data.GroupId,
+			Error:    result.Error,
+		}
+		if entries[i].GroupId == "" && data.Id != "" {
+			entries[i].GroupId = groupId
+		}
+		if len(domain) > 0 && data.Cid != "" {
+			entries[i].URL = gatewayURL(string(domain), data.Cid)
+		}
+	}
+
+	var data []byte
+	var err error
+	if strings.EqualFold(filepath.Ext(manifestPath), ".csv") {
+		data, err = manifestCSV(entries)
+	} else {
+		data, err = json.MarshalIndent(entries, "", "    ")
+	}
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(manifestPath, append(data, '\n'), 0644)
+}
+
+func manifestCSV(entries []ManifestEntry) ([]byte, error) {
+	buf := &bytes.Buffer{}
+	writer := csv.NewWriter(buf)
+	err := writer.Write(manifestColumns)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		err = writer.Write([]string{
+			entry.Path,
+			entry.Id,
+			entry.Name,
+			entry.Cid,
+			strconv.Itoa(entry.Size),
+			entry.MimeType,
+			entry.GroupId,
+			entry.URL,
+			entry.Error,
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	writer.Flush()
+	return bytes.TrimSuffix(buf.Bytes(), []byte("\n")), writer.Error()
+}
@@ -0,0 +1,517 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"reflect"
+	"strings"
+	"text/tabwriter"
+	"text/template"
+
+	"github.com/urfave/cli/v2"
+	"gopkg.in/yaml.v3"
+)
+
+var outputFormats = []string{"json", "json-compact", "ndjson", "table", "yaml", "csv", "plain"}
+
+type OutputOptions struct {
+	Format   string
+	Template string
+	Fields   []string
+}
+
+// output is set from the --output flag before a command runs
+var output = OutputOptions{Format: "json"}
+
+func outputFlags() []cli.Flag {
+	return []cli.Flag{
+		&cli.StringFlag{
+			Name:    "output",
+			Value:   "json",
+			Usage:   "Output format: " + strings.Join(outputFormats, ", "),
+			EnvVars: []string{"PINATA_OUTPUT"},
+		},
+		&cli.StringFlag{
+			Name:  "template",
+			Usage: "Go template applied to each item instead of an output format, e.g. '{{.Cid}}'",
+		},
+		&cli.StringFlag{
+			Name:  "fields",
+			Usage: "Comma separated list of fields to include, e.g. id,cid,name",
+		},
+	}
+}
+
+// withOutput adds the output flags to a command that renders API data so
+// they can be passed after the command as well as before it
+func withOutput(cmd *cli.Command) *cli.Command {
+	cmd.Flags = append(cmd.Flags, outputFlags()...)
+	cmd.Before = applyOutputFlags
+	return cmd
+}
+
+// applyOutputFlags uses the closest command in the lineage that had the
+// output flags set, falling back to the global flags
+func applyOutputFlags(ctx *cli.Context) error {
+	if c := outputFlagContext(ctx, "output"); c != nil {
+		output.Format = c.String("output")
+	} else {
+		output.Format = settingString("output")
+	}
+	if c := outputFlagContext(ctx, "template"); c != nil {
+		output.Template = c.String("template")
+	}
+	if c := outputFlagContext(ctx, "fields"); c != nil {
+		output.Fields = nil
+		for _, field := range strings.Split(c.String("fields"), ",") {
+			if field = strings.TrimSpace(field); field != "" {
+				output.Fields = append(output.Fields, field)
+			}
+		}
+	}
+
+	for _, format := range outputFormats {
+		if output.Format == format {
+			return nil
+		}
+	}
+	return fmt.Errorf("unknown output format %q, use one of: %s", output.Format, strings.Join(outputFormats, ", "))
+}
+
+func outputFlagContext(ctx *cli.Context, name string) *cli.Context {
+	for _, c := range ctx.Lineage() {
+		if c.IsSet(name) {
+			return c
+		}
+	}
+	return nil
+}
+
+func isTabular() bool {
+	switch output.Format {
+	case "table", "csv", "plain", "ndjson":
+		return true
+	}
+	return false
+}
+
+// render prints data in the selected output format. The document formats
+// print data as a whole while the tabular formats print one line per item
+// in rows, which is usually data itself or the slice of items inside it.
+func render(data interface{}, rows interface{}) error {
+	return renderTo(os.Stdout, data, rows)
+}
+
+func renderTo(w io.Writer, data interface{}, rows interface{}) error {
+	if output.Template != "" {
+		return renderTemplate(w, rows)
+	}
+	if len(output.Fields) > 0 {
+		return renderFields(w, rows)
+	}
+
+	switch output.Format {
+	case "table", "csv", "plain":
+		columns, records := tableRecords(rows)
+		return renderRecords(w, columns, records)
+	}
+	return renderDocument(w, data, rows)
+}
+
+func renderDocument(w io.Writer, data interface{}, rows interface{}) error {
+	switch output.Format {
+	case "json-compact":
+		formattedJSON, err := json.Marshal(data)
+		if err != nil {
+			return errors.New("failed to format JSON")
+		}
+		fmt.Fprintln(w, string(formattedJSON))
+	case "ndjson":
+		for _, row := range rowValues(rows) {
+			formattedJSON, err := json.Marshal(row.Interface())
+			if err != nil {
+				return errors.New("failed to format JSON")
+			}
+			fmt.Fprintln(w, string(formattedJSON))
+		}
+	case "yaml":
+		node, err := yamlNode(data)
+		if err != nil {
+			return errors.Join(err, errors.New("failed to format YAML"))
+		}
+		encoder := yaml.NewEncoder(w)
+		encoder.SetIndent(2)
+		if err := encoder.Encode(node); err != nil {
+			return errors.Join(err, errors.New("failed to format YAML"))
+		}
+		return encoder.Close()
+	default:
+		formattedJSON, err := json.MarshalIndent(data, "", "    ")
+		if err != nil {
+			return errors.New("failed to format JSON")
+		}
+		fmt.Fprintln(w, string(formattedJSON))
+	}
+	return nil
+}
+
+func renderRecords(w io.Writer, columns []string, records [][]string) error {
+	switch output.Format {
+	case "csv":
+		writer := csv.NewWriter(w)
+		if err := writer.Write(columns); err != nil {
+			return err
+		}
+		return writer.WriteAll(records)
+	case "plain":
+		for _, record := range records {
+			fmt.Fprintln(w, strings.Join(record, "\t"))
+		}
+		return nil
+	default:
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		header := make([]string, len(columns))
+		for i, column := range columns {
+			header[i] = strings.ToUpper(column)
+		}
+		fmt.Fprintln(tw, strings.Join(header, "\t"))
+		for _, record := range records {
+			fmt.Fprintln(tw, strings.Join(record, "\t"))
+		}
+		return tw.Flush()
+	}
+}
+
+// renderNextPage lets users of the tabular formats know there are more
+// results, since the page token is only part of the document formats
+func renderNextPage(token string) {
+	if token != "" && isTabular() {
+		fmt.Fprintf(os.Stderr, "Next page token: %s\n", token)
+	}
+}
+
+func rowValues(rows interface{}) []reflect.Value {
+	v := reflect.ValueOf(rows)
+	for v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return nil
+		}
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Slice && v.Kind() != reflect.Array {
+		return []reflect.Value{v}
+	}
+	values := make([]reflect.Value, v.Len())
+	for i := 0; i < v.Len(); i++ {
+		values[i] = v.Index(i)
+	}
+	return values
+}
+
+type column struct {
+	name  string
+	index []int
+}
+
+func tableRecords(rows interface{}) ([]string, [][]string) {
+	columns, values := tableValues(rows)
+	return columns, formatRecords(values)
+}
+
+func formatRecords(values [][]reflect.Value) [][]string {
+	records := make([][]string, len(values))
+	for i, row := range values {
+		records[i] = make([]string, len(row))
+		for j, value := range row {
+			records[i][j] = formatCell(value)
+		}
+	}
+	return records
+}
+
+// tableValues splits rows into named columns and the value of each column
+// for every row
+func tableValues(rows interface{}) ([]string, [][]reflect.Value) {
+	values := rowValues(rows)
+	if len(values) == 0 {
+		return []string{}, [][]reflect.Value{}
+	}
+
+	elemType := values[0].Type()
+	for elemType.Kind() == reflect.Pointer {
+		elemType = elemType.Elem()
+	}
+	if elemType.Kind() != reflect.Struct {
+		records := make([][]reflect.Value, len(values))
+		for i, value := range values {
+			records[i] = []reflect.Value{value}
+		}
+		return []string{"value"}, records
+	}
+
+	columns := structColumns(elemType, nil)
+	names := make([]string, len(columns))
+	for i, col := range columns {
+		names[i] = col.name
+	}
+
+	records := make([][]reflect.Value, len(values))
+	for i, value := range values {
+		for value.Kind() == reflect.Pointer && !value.IsNil() {
+			value = value.Elem()
+		}
+		record := make([]reflect.Value, len(columns))
+		for j, col := range columns {
+			if value.Kind() != reflect.Struct {
+				continue
+			}
+			record[j] = value.FieldByIndex(col.index)
+		}
+		records[i] = record
+	}
+	return names, records
+}
+
+// structColumns lists the exported fields of a struct by their JSON names,
+// flattening embedded structs the same way encoding/json does
+func structColumns(t reflect.Type, parent []int) []column {
+	columns := []column{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		index := append(append([]int{}, parent...), i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			columns = append(columns, structColumns(field.Type, index)...)
+			continue
+		}
+		if !field.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+		columns = append(columns, column{name: name, index: index})
+	}
+	return columns
+}
+
+func formatCell(v reflect.Value) string {
+	if !v.IsValid() {
+		return ""
+	}
+	for v.Kind() == reflect.Pointer || v.Kind() == reflect.Interface {
+		if v.IsNil() {
+			return ""
+		}
+		v = v.Elem()
+	}
+	switch v.Kind() {
+	case reflect.String:
+		return v.String()
+	case reflect.Map, reflect.Slice:
+		if v.IsNil() {
+			return ""
+		}
+		fallthrough
+	case reflect.Struct, reflect.Array:
+		formattedJSON, err := json.Marshal(v.Interface())
+		if err != nil {
+			return ""
+		}
+		return string(formattedJSON)
+	default:
+		return fmt.Sprint(v.Interface())
+	}
+}
+
+// yamlNode converts data to a YAML document through its JSON encoding so
+// the keys and their order match the JSON output
+func yamlNode(data interface{}) (*yaml.Node, error) {
+	formattedJSON, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	decoder := json.NewDecoder(bytes.NewReader(formattedJSON))
+	decoder.UseNumber()
+	return decodeYAMLNode(decoder)
+}
+
+func decodeYAMLNode(decoder *json.Decoder) (*yaml.Node, error) {
+	token, err := decoder.Token()
+	if err != nil {
+		return nil, err
+	}
+
+	switch t := token.(type) {
+	case json.Delim:
+		if t == '{' {
+			node := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+			for decoder.More() {
+				key, err := decoder.Token()
+				if err != nil {
+					return nil, err
+				}
+				value, err := decodeYAMLNode(decoder)
+				if err != nil {
+					return nil, err
+				}
+				node.Content = append(node.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: key.(string)}, value)
+			}
+			_, err := decoder.Token()
+			return node, err
+		}
+		node := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for decoder.More() {
+			value, err := decodeYAMLNode(decoder)
+			if err != nil {
+				return nil, err
+			}
+			node.Content = append(node.Content, value)
+		}
+		_, err := decoder.Token()
+		return node, err
+	case string:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: t}, nil
+	case json.Number:
+		tag := "!!int"
+		if strings.ContainsAny(t.String(), ".eE") {
+			tag = "!!float"
+		}
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: tag, Value: t.String()}, nil
+	case bool:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!bool", Value: fmt.Sprint(t)}, nil
+	default:
+		return &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!null", Value: "null"}, nil
+	}
+}
+
+// selectFields keeps the requested columns in the order they were asked
+// for, matching names without regard to case
+func selectFields(columns []string, values [][]reflect.Value) ([]string, [][]reflect.Value, error) {
+	indexes := make([]int, len(output.Fields))
+	for i, field := range output.Fields {
+		indexes[i] = -1
+		for j, column := range columns {
+			if strings.EqualFold(field, column) || strings.EqualFold(strings.ReplaceAll(field, "_", ""), strings.ReplaceAll(column, "_", "")) {
+				indexes[i] = j
+				break
+			}
+		}
+		if indexes[i] == -1 && len(values) > 0 {
+			return nil, nil, fmt.Errorf("unknown field %q, available fields: %s", field, strings.Join(columns, ", "))
+		}
+	}
+
+	selected := make([]string, len(indexes))
+	for i, index := range indexes {
+		selected[i] = output.Fields[i]
+		if index >= 0 {
+			selected[i] = columns[index]
+		}
+	}
+	rows := make([][]reflect.Value, len(values))
+	for i, row := range values {
+		rows[i] = make([]reflect.Value, len(indexes))
+		for j, index := range indexes {
+			rows[i][j] = row[index]
+		}
+	}
+	return selected, rows, nil
+}
+
+// fieldRow is a row limited to the selected fields that keeps their order
+// when encoded as JSON
+type fieldRow struct {
+	columns []string
+	values  []reflect.Value
+}
+
+func (r fieldRow) MarshalJSON() ([]byte, error) {
+	buf := &bytes.Buffer{}
+	buf.WriteByte('{')
+	for i, column := range r.columns {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		key, err := json.Marshal(column)
+		if err != nil {
+			return nil, err
+		}
+		var value interface{}
+		if r.values[i].IsValid() {
+			value = r.values[i].Interface()
+		}
+		encoded, err := json.Marshal(value)
+		if err != nil {
+			return nil, err
+		}
+		buf.Write(key)
+		buf.WriteByte(':')
+		buf.Write(encoded)
+	}
+	buf.WriteByte('}')
+	return buf.Bytes(), nil
+}
+
+// renderFields prints only the --fields of each item. The document formats
+// print the list of items since the fields apply to the items rather than
+// the whole response.
+func renderFields(w io.Writer, rows interface{}) error {
+	columns, values, err := selectFields(tableValues(rows))
+	if err != nil {
+		return err
+	}
+
+	switch output.Format {
+	case "table", "csv", "plain":
+		return renderRecords(w, columns, formatRecords(values))
+	}
+
+	selected := make([]fieldRow, len(values))
+	for i, row := range values {
+		selected[i] = fieldRow{columns: columns, values: row}
+	}
+	return renderDocument(w, selected, selected)
+}
+
+var templateFuncs = template.FuncMap{
+	"json": func(v interface{}) (string, error) {
+		formattedJSON, err := json.Marshal(v)
+		return string(formattedJSON), err
+	},
+	"join":  strings.Join,
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+}
+
+// renderTemplate executes the --template once for each item in rows, with
+// the typed struct of the item as the data
+func renderTemplate(w io.Writer, rows interface{}) error {
+	tmpl, err := template.New("output").Funcs(templateFuncs).Parse(output.Template)
+	if err != nil {
+		return errors.Join(err, errors.New("failed to parse template"))
+	}
+	for _, row := range rowValues(rows) {
+		buf := &bytes.Buffer{}
+		err := tmpl.Execute(buf, row.Interface())
+		if err != nil {
+			return errors.Join(err, errors.New("failed to execute template"))
+		}
+		if !bytes.HasSuffix(buf.Bytes(), []byte("\n")) {
+			buf.WriteByte('\n')
+		}
+		_, err = w.Write(buf.Bytes())
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
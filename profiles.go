@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+)
+
+type ProfileItem struct {
+	Name        string `json:"name"`
+	Current     bool   `json:"current"`
+	Gateway     string `json:"gateway"`
+	Group       string `json:"group"`
+	APIHost     string `json:"api_host"`
+	UploadsHost string `json:"uploads_host"`
+}
+
+func ListProfiles() ([]ProfileItem, error) {
+	config, err := loadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, 0, len(config.Profiles))
+	for name := range config.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	items := make([]ProfileItem, len(names))
+	for i, name := range names {
+		profile := config.Profiles[name]
+		items[i] = ProfileItem{
+			Name:        name,
+			Current:     name == config.ActiveProfileName(),
+			Gateway:     profile.Gateway,
+			Group:       profile.Group,
+			APIHost:     profile.APIHost,
+			UploadsHost: profile.UploadsHost,
+		}
+	}
+
+	err = render(items, items)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func UseProfile(name string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := config.Profiles[name]; !ok {
+		return fmt.Errorf("profile %q not found, create it with 'pinata --profile %s auth'", name, name)
+	}
+
+	config.CurrentProfile = name
+	err = saveConfig(config)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Now using profile %s\n", name)
+	return nil
+}
+
+func RemoveProfile(name string) error {
+	config, err := loadConfig()
+	if err != nil {
+		return err
+	}
+	if _, ok := config.Profiles[name]; !ok {
+		return fmt.Errorf("profile %q not found", name)
+	}
+
+	delete(config.Profiles, name)
+	if config.CurrentProfile == name {
+		config.CurrentProfile = ""
+	}
+	err = saveConfig(config)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Profile %s removed\n", name)
+	return nil
+}
@@ -0,0 +1,153 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+	"github.com/schollz/progressbar/v3"
+)
+
+// multiProgress draws a progress bar for each upload in flight below the
+// lines of the uploads that ended. The bars are only drawn on a terminal,
+// elsewhere only the ended uploads are printed.
+type multiProgress struct {
+	out         io.Writer
+	interactive bool
+
+	mu    sync.Mutex
+	bars  []*progressLine
+	ended []string
+	// drawn is the number of bar lines drawn last, to be cleared on redraw
+	drawn int
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// progressLine keeps the last line a progress bar rendered, the bars write
+// to it instead of the terminal so multiProgress can draw them together
+type progressLine struct {
+	mu   sync.Mutex
+	line string
+}
+
+func (l *progressLine) Write(p []byte) (int, error) {
+	line := strings.TrimLeft(string(p), "\r")
+	// Lines that only clear the bar are skipped
+	if strings.TrimSpace(strings.Trim(line, "\r")) != "" {
+		l.mu.Lock()
+		l.line = line
+		l.mu.Unlock()
+	}
+	return len(p), nil
+}
+
+func (l *progressLine) String() string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return l.line
+}
+
+func newMultiProgress(out *os.File) *multiProgress {
+	m := &multiProgress{
+		out:         out,
+		interactive: isatty.IsTerminal(out.Fd()) || isatty.IsCygwinTerminal(out.Fd()),
+		stop:        make(chan struct{}),
+		done:        make(chan struct{}),
+	}
+	go func() {
+		defer close(m.done)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-m.stop:
+				m.redraw()
+				return
+			case <-ticker.C:
+				m.redraw()
+			}
+		}
+	}()
+	return m
+}
+
+// Add starts a bar for an upload of size bytes. end removes the bar and
+// prints message in its place.
+func (m *multiProgress) Add(name string, size int64) (progress *uploadProgress, end func(message string)) {
+	line := &progressLine{}
+	bar := progressbar.NewOptions64(
+		size,
+		progressbar.OptionSetWriter(line),
+		progressbar.OptionEnableColorCodes(true),
+		progressbar.OptionShowBytes(true),
+		progressbar.OptionSetDescription(progressName(name)),
+		progressbar.OptionSetWidth(20),
+		progressbar.OptionSetTheme(progressbar.Theme{
+			Saucer:        "█",
+			SaucerPadding: " ",
+			BarStart:      "|",
+			BarEnd:        "|",
+		}),
+	)
+	bar.RenderBlank()
+
+	m.mu.Lock()
+	m.bars = append(m.bars, line)
+	m.mu.Unlock()
+
+	return &uploadProgress{bar: bar}, func(message string) {
+		m.mu.Lock()
+		defer m.mu.Unlock()
+		for i, l := range m.bars {
+			if l == line {
+				m.bars = append(m.bars[:i], m.bars[i+1:]...)
+				break
+			}
+		}
+		m.ended = append(m.ended, message)
+	}
+}
+
+// Stop draws the last ended uploads and stops redrawing
+func (m *multiProgress) Stop() {
+	close(m.stop)
+	<-m.done
+}
+
+func (m *multiProgress) redraw() {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var sb strings.Builder
+	if m.interactive && m.drawn > 0 {
+		// Move up to the first bar and clear everything below it
+		fmt.Fprintf(&sb, "\r\033[%dA\033[J", m.drawn)
+	}
+	for _, message := range m.ended {
+		sb.WriteString(message + "\n")
+	}
+	m.ended = nil
+	m.drawn = 0
+	if m.interactive {
+		for _, line := range m.bars {
+			sb.WriteString(line.String() + "\n")
+			m.drawn++
+		}
+	}
+	io.WriteString(m.out, sb.String())
+}
+
+// progressName shortens a path to fit next to its bar
+func progressName(name string) string {
+	const max = 30
+	if len(name) <= max {
+		return fmt.Sprintf("%-*s ", max, name)
+	}
+	return "..." + name[len(name)-max+3:] + " "
+}
@@ -0,0 +1,380 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// fingerprintSampleSize is how much of the start and end of a file is hashed
+// into its fingerprint
+const fingerprintSampleSize = 1024 * 1024
+
+// UploadRecord is a TUS upload that was started but hasn't finished, saved
+// so that a later run can resume it from the offset the server has
+type UploadRecord struct {
+	Fingerprint string            `json:"fingerprint"`
+	URL         string            `json:"url"`
+	Path        string            `json:"path"`
+	Size        int64             `json:"size"`
+	GroupId     string            `json:"group_id,omitempty"`
+	Name        string            `json:"name,omitempty"`
+	KeyValues   map[string]string `json:"keyvalues,omitempty"`
+	Car         bool              `json:"car,omitempty"`
+	Profile     string            `json:"profile"`
+	CreatedAt   string            `json:"created_at"`
+}
+
+type UploadItem struct {
+	Id        string `json:"id"`
+	Path      string `json:"path"`
+	Size      int64  `json:"size"`
+	Offset    int64  `json:"offset"`
+	Status    string `json:"status"`
+	GroupId   string `json:"group_id"`
+	Name      string `json:"name"`
+	Profile   string `json:"profile"`
+	CreatedAt string `json:"created_at"`
+	URL       string `json:"url"`
+}
+
+// uploadRecordsMu guards the read-modify-write of the uploads file
+var uploadRecordsMu sync.Mutex
+
+func uploadRecordsPath() (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "uploads.json"), nil
+}
+
+func loadUploadRecords() (map[string]UploadRecord, error) {
+	records := map[string]UploadRecord{}
+
+	p, err := uploadRecordsPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return records, nil
+		}
+		return nil, err
+	}
+
+	err = json.Unmarshal(data, &records)
+	if err != nil {
+		return nil, errors.Join(err, errors.New("failed to parse uploads file "+p))
+	}
+	return records, nil
+}
+
+// updateUploadRecords applies update to the saved uploads and writes them back
+func updateUploadRecords(update func(records map[string]UploadRecord)) error {
+	uploadRecordsMu.Lock()
+	defer uploadRecordsMu.Unlock()
+
+	records, err := loadUploadRecords()
+	if err != nil {
+		return err
+	}
+	update(records)
+
+	p, err := uploadRecordsPath()
+	if err != nil {
+		return err
+	}
+	err = os.MkdirAll(filepath.Dir(p), 0700)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(records, "", "    ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, data, 0600)
+}
+
+// uploadStore implements tus.Store on top of the uploads file. record holds
+// the details saved alongside the URL of the upload it is used for.
+type uploadStore struct {
+	record UploadRecord
+}
+
+func (s *uploadStore) Get(fingerprint string) (string, bool) {
+	records, err := loadUploadRecords()
+	if err != nil {
+		return "", false
+	}
+	record, ok := records[fingerprint]
+	if !ok || record.URL == "" {
+		return "", false
+	}
+	return record.URL, true
+}
+
+func (s *uploadStore) Set(fingerprint string, url string) {
+	record := s.record
+	record.Fingerprint = fingerprint
+	record.URL = url
+	record.CreatedAt = time.Now().UTC().Format(time.RFC3339)
+	err := updateUploadRecords(func(records map[string]UploadRecord) {
+		records[fingerprint] = record
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not save upload for resuming: %v\n", err)
+	}
+}
+
+func (s *uploadStore) Delete(fingerprint string) {
+	err := updateUploadRecords(func(records map[string]UploadRecord) {
+		delete(records, fingerprint)
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not remove finished upload: %v\n", err)
+	}
+}
+
+func (s *uploadStore) Close() {}
+
+// uploadFingerprint identifies an upload of a file by its path, size, mtime
+// and a hash of its first and last MB, along with where and how it is
+// uploaded, so a changed file or different options start a new upload
+func uploadFingerprint(filePath string, stats os.FileInfo, uploadsURL string, metadata map[string]string) (string, error) {
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	f, err := os.Open(filePath)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%d\n%d\n%s\n", absPath, stats.Size(), stats.ModTime().UnixNano(), uploadsURL)
+
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		fmt.Fprintf(h, "%s=%s\n", key, metadata[key])
+	}
+
+	_, err = io.CopyN(h, f, fingerprintSampleSize)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if stats.Size() > fingerprintSampleSize {
+		_, err = f.Seek(-fingerprintSampleSize, io.SeekEnd)
+		if err != nil {
+			return "", err
+		}
+		_, err = io.Copy(h, f)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// uploadOffset asks the server how much of an upload it has received
+func uploadOffset(client *Client, uploadURL string) (int64, error) {
+	req, err := client.NewRequest("HEAD", uploadURL, nil)
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Del("content-type")
+
+	resp, err := client.HTTPClient.Do(req)
+	if err != nil {
+		return 0, errors.Join(err, errors.New("failed to send the request"))
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return 0, newAPIError(resp)
+	}
+
+	return strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+}
+
+// findUploadRecord looks up a saved upload by its ID, a prefix of it or the
+// path of the file being uploaded
+func findUploadRecord(ref string) (UploadRecord, error) {
+	records, err := loadUploadRecords()
+	if err != nil {
+		return UploadRecord{}, err
+	}
+
+	absRef, _ := filepath.Abs(ref)
+	var matches []UploadRecord
+	for fingerprint, record := range records {
+		if strings.HasPrefix(fingerprint, ref) || record.Path == absRef {
+			matches = append(matches, record)
+		}
+	}
+
+	switch len(matches) {
+	case 0:
+		return UploadRecord{}, fmt.Errorf("no upload found matching %q, see 'pinata uploads list'", ref)
+	case 1:
+		return matches[0], nil
+	}
+	return UploadRecord{}, fmt.Errorf("%q matches %d uploads, use a longer ID", ref, len(matches))
+}
+
+func ListUploads() ([]UploadItem, error) {
+	records, err := loadUploadRecords()
+	if err != nil {
+		return nil, err
+	}
+
+	items := make([]UploadItem, 0, len(records))
+	for _, record := range records {
+		items = append(items, UploadItem{
+			Id:        record.Fingerprint[:12],
+			Path:      record.Path,
+			Size:      record.Size,
+			GroupId:   record.GroupId,
+			Name:      record.Name,
+			Profile:   record.Profile,
+			CreatedAt: record.CreatedAt,
+			URL:       record.URL,
+		})
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].CreatedAt < items[j].CreatedAt
+	})
+
+	// Each upload is checked with the profile it was started with, since its
+	// URL belongs to that account
+	clients := map[string]*Client{}
+	for i, item := range items {
+		client, ok := clients[item.Profile]
+		if !ok {
+			client, err = NewClientForProfile(item.Profile)
+			if err != nil {
+				items[i].Status = "unknown"
+				continue
+			}
+			clients[item.Profile] = client
+		}
+		offset, err := uploadOffset(client, item.URL)
+		var apiErr *APIError
+		switch {
+		case err == nil:
+			items[i].Offset = offset
+			items[i].Status = "in progress"
+		case errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusGone || apiErr.StatusCode == http.StatusForbidden):
+			items[i].Status = "expired"
+		default:
+			items[i].Status = "unknown"
+		}
+	}
+
+	err = render(items, items)
+	if err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// ResumeUpload continues a saved upload with the options it was started with
+func ResumeUpload(ref string, verbose bool) (UploadResponse, error) {
+	record, err := findUploadRecord(ref)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+
+	stats, err := os.Stat(record.Path)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	if stats.Size() != record.Size {
+		return UploadResponse{}, fmt.Errorf("%s changed since the upload started, abort it with 'pinata uploads abort %s'", record.Path, record.Fingerprint[:12])
+	}
+
+	// The upload URL belongs to the account the upload was started with
+	options := UploadOptions{
+		GroupId:   record.GroupId,
+		Name:      record.Name,
+		KeyValues: record.KeyValues,
+		Profile:   record.Profile,
+		Verbose:   verbose,
+	}
+	if options.Name == "" {
+		options.Name = "nil"
+	}
+	response, err := uploadWithTUS(record.Path, options, stats, record.Car)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	// Packed folders are only kept until their upload finishes
+	if record.Car {
+		os.Remove(record.Path)
+	}
+
+	err = render(response.Data, response.Data)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+
+	return response, nil
+}
+
+// AbortUpload terminates a saved upload on the server and forgets it
+func AbortUpload(ref string) error {
+	record, err := findUploadRecord(ref)
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClientForProfile(record.Profile)
+	if err != nil {
+		return err
+	}
+
+	req, err := client.NewRequest("DELETE", record.URL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	err = client.Do(req, nil)
+	var apiErr *APIError
+	if err != nil && !(errors.As(err, &apiErr) && (apiErr.StatusCode == http.StatusNotFound || apiErr.StatusCode == http.StatusGone)) {
+		return err
+	}
+
+	err = updateUploadRecords(func(records map[string]UploadRecord) {
+		delete(records, record.Fingerprint)
+	})
+	if err != nil {
+		return err
+	}
+	// Packed folders are only kept to resume their upload
+	if record.Car {
+		os.Remove(record.Path)
+	}
+
+	fmt.Println("Upload Aborted")
+	return nil
+}
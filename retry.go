@@ -0,0 +1,91 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+)
+
+const retryBaseDelay = 500 * time.Millisecond
+
+type RetryPolicy struct {
+	MaxRetries int
+	MaxBackoff time.Duration
+	Jitter     bool
+}
+
+// retryPolicy is set from the global flags before any command runs
+var retryPolicy = RetryPolicy{
+	MaxRetries: 3,
+	MaxBackoff: 30 * time.Second,
+	Jitter:     true,
+}
+
+func isIdempotent(method string) bool {
+	switch method {
+	case "GET", "HEAD", "PUT", "DELETE", "OPTIONS":
+		return true
+	}
+	return false
+}
+
+func shouldRetryStatus(status int) bool {
+	switch status {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// backoff returns how long to wait before the next attempt, preferring the
+// server's Retry-After header when one was sent. Neither waits longer than
+// MaxBackoff.
+func (p RetryPolicy) backoff(attempt int, resp *http.Response) time.Duration {
+	if resp != nil {
+		if delay, ok := parseRetryAfter(resp.Header.Get("Retry-After")); ok {
+			if delay > p.MaxBackoff {
+				delay = p.MaxBackoff
+			}
+			return delay
+		}
+	}
+
+	delay := retryBaseDelay << attempt
+	if delay <= 0 || delay > p.MaxBackoff {
+		delay = p.MaxBackoff
+	}
+	if p.Jitter && delay > 0 {
+		delay = delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+	}
+	return delay
+}
+
+func (p RetryPolicy) wait(attempt int, resp *http.Response, reason string) {
+	delay := p.backoff(attempt, resp)
+	fmt.Fprintf(os.Stderr, "Request failed (%s), retrying in %s (attempt %d/%d)\n", reason, delay.Round(time.Millisecond), attempt+1, p.MaxRetries)
+	time.Sleep(delay)
+}
+
+func parseRetryAfter(value string) (time.Duration, bool) {
+	if value == "" {
+		return 0, false
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds >= 0 {
+		return time.Duration(seconds) * time.Second, true
+	}
+	if date, err := http.ParseTime(value); err == nil {
+		delay := time.Until(date)
+		if delay < 0 {
+			delay = 0
+		}
+		return delay, true
+	}
+	return 0, false
+}
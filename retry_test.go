@@ -0,0 +1,98 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+)
+
+func TestBackoff(t *testing.T) {
+	policy := RetryPolicy{MaxBackoff: 30 * time.Second}
+	tests := []struct {
+		attempt int
+		delay   time.Duration
+	}{
+		{0, 500 * time.Millisecond},
+		{1, time.Second},
+		{2, 2 * time.Second},
+		{5, 16 * time.Second},
+		{6, 30 * time.Second},
+		{40, 30 * time.Second},
+		{64, 30 * time.Second},
+	}
+	for _, test := range tests {
+		if delay := policy.backoff(test.attempt, nil); delay != test.delay {
+			t.Errorf("attempt %d: got %s, want %s", test.attempt, delay, test.delay)
+		}
+	}
+
+	// The delay never shrinks or goes past the cap when the shift overflows
+	var last time.Duration
+	for attempt := 0; attempt < 200; attempt++ {
+		delay := policy.backoff(attempt, nil)
+		if delay < last || delay > policy.MaxBackoff {
+			t.Fatalf("attempt %d: got %s after %s", attempt, delay, last)
+		}
+		last = delay
+	}
+}
+
+func TestBackoffJitter(t *testing.T) {
+	policy := RetryPolicy{MaxBackoff: 30 * time.Second, Jitter: true}
+	for _, attempt := range []int{0, 3, 10, 100} {
+		full := RetryPolicy{MaxBackoff: policy.MaxBackoff}.backoff(attempt, nil)
+		for i := 0; i < 1000; i++ {
+			delay := policy.backoff(attempt, nil)
+			if delay < full/2 || delay > full {
+				t.Fatalf("attempt %d: got %s, want between %s and %s", attempt, delay, full/2, full)
+			}
+		}
+	}
+}
+
+func TestBackoffRetryAfter(t *testing.T) {
+	policy := RetryPolicy{MaxBackoff: 30 * time.Second, Jitter: true}
+	tests := []struct {
+		retryAfter string
+		min, max   time.Duration
+	}{
+		{"0", 0, 0},
+		{"7", 7 * time.Second, 7 * time.Second},
+		{"3600", 30 * time.Second, 30 * time.Second},
+		{time.Now().Add(10 * time.Second).UTC().Format(http.TimeFormat), 8 * time.Second, 10 * time.Second},
+		{time.Now().Add(time.Hour).UTC().Format(http.TimeFormat), 30 * time.Second, 30 * time.Second},
+		{time.Now().Add(-time.Hour).UTC().Format(http.TimeFormat), 0, 0},
+		// Headers that can't be parsed fall back to the attempt's delay
+		{"-1", 250 * time.Millisecond, 500 * time.Millisecond},
+		{"soon", 250 * time.Millisecond, 500 * time.Millisecond},
+	}
+	for _, test := range tests {
+		resp := &http.Response{Header: http.Header{"Retry-After": {test.retryAfter}}}
+		delay := policy.backoff(0, resp)
+		if delay < test.min || delay > test.max {
+			t.Errorf("Retry-After %q: got %s, want between %s and %s", test.retryAfter, delay, test.min, test.max)
+		}
+	}
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	tests := []struct {
+		value string
+		delay time.Duration
+		ok    bool
+	}{
+		{"", 0, false},
+		{"0", 0, true},
+		{"120", 2 * time.Minute, true},
+		{"-5", 0, false},
+		{"1.5", 0, false},
+		{"Wed, 21 Oct 2015 07:28:00 GMT", 0, true},
+		{"next week", 0, false},
+	}
+	for _, test := range tests {
+		delay, ok := parseRetryAfter(test.value)
+		if delay != test.delay || ok != test.ok {
+			t.Errorf("parseRetryAfter(%q) = %s, %t, want %s, %t", test.value, delay, ok, test.delay, test.ok)
+		}
+	}
+}
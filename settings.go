@@ -0,0 +1,207 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+type settingKind int
+
+const (
+	kindString settingKind = iota
+	kindInt
+	kindBool
+	kindDuration
+)
+
+// Setting is a configurable value that can come from a flag, an environment
+// variable, the active profile or the [defaults] table of the config file,
+// in that order of precedence, before falling back to Default.
+type Setting struct {
+	Key     string
+	Env     string
+	Default string
+	Usage   string
+	Kind    settingKind
+	Profile bool
+	Secret  bool
+	// Positive rejects integers below 1
+	Positive bool
+}
+
+var settings = []Setting{
+	{Key: "jwt", Env: "PINATA_JWT", Usage: "Pinata JWT used to authorize requests", Profile: true, Secret: true},
+	{Key: "gateway", Usage: "Default gateway domain", Profile: true},
+	{Key: "group", Usage: "Default group ID for uploads", Profile: true},
+	{Key: "api_host", Env: "PINATA_HOST", Default: "api.pinata.cloud", Usage: "Host of the Pinata API", Profile: true},
+	{Key: "uploads_host", Env: "PINATA_UPLOADS_HOST", Default: "uploads.pinata.cloud", Usage: "Host of the Pinata uploads API", Profile: true},
+	{Key: "scheme", Env: "PINATA_SCHEME", Default: "https", Usage: "Scheme used for hosts that don't include one"},
+	{Key: "output", Env: "PINATA_OUTPUT", Default: "json", Usage: "Default output format"},
+	{Key: "sign_expires", Env: "PINATA_SIGN_EXPIRES", Default: "30", Usage: "Seconds a signed URL is valid for", Kind: kindInt, Positive: true},
+	{Key: "upload_threshold", Env: "PINATA_UPLOAD_THRESHOLD", Default: strconv.Itoa(MAX_SIZE_REGULAR_UPLOAD), Usage: "Size in bytes above which files and folders are uploaded with TUS", Kind: kindInt, Positive: true},
+	{Key: "upload_concurrency", Env: "PINATA_UPLOAD_CONCURRENCY", Default: "4", Usage: "Number of paths uploaded at the same time", Kind: kindInt, Positive: true},
+	{Key: "chunk_size", Env: "PINATA_CHUNK_SIZE", Default: strconv.Itoa(CHUNK_SIZE), Usage: "Size in bytes of each TUS upload chunk", Kind: kindInt, Positive: true},
+	{Key: "retries", Env: "PINATA_RETRIES", Default: "3", Usage: "Number of times to retry a failed request", Kind: kindInt},
+	{Key: "retry_max_backoff", Env: "PINATA_RETRY_MAX_BACKOFF", Default: "30s", Usage: "Longest time to wait between retries", Kind: kindDuration},
+	{Key: "retry_jitter", Env: "PINATA_RETRY_JITTER", Default: "true", Usage: "Randomize the wait between retries", Kind: kindBool},
+}
+
+func findSetting(key string) (Setting, error) {
+	for _, setting := range settings {
+		if setting.Key == key {
+			return setting, nil
+		}
+	}
+	keys := make([]string, len(settings))
+	for i, setting := range settings {
+		keys[i] = setting.Key
+	}
+	return Setting{}, fmt.Errorf("unknown config key %q, use one of: %s", key, strings.Join(keys, ", "))
+}
+
+// validate checks that value can be parsed as the setting's kind
+func (s Setting) validate(value string) error {
+	var err error
+	switch s.Kind {
+	case kindInt:
+		var n int
+		n, err = strconv.Atoi(value)
+		if err == nil && s.Positive && n < 1 {
+			return fmt.Errorf("invalid value %q for %s, it must be greater than 0", value, s.Key)
+		}
+	case kindBool:
+		_, err = strconv.ParseBool(value)
+	case kindDuration:
+		_, err = time.ParseDuration(value)
+	}
+	if err != nil {
+		return fmt.Errorf("invalid value %q for %s", value, s.Key)
+	}
+	return nil
+}
+
+// typedValue converts value so it is saved in the config file with the
+// matching TOML type
+func (s Setting) typedValue(value string) interface{} {
+	switch s.Kind {
+	case kindInt:
+		parsed, _ := strconv.ParseInt(value, 10, 64)
+		return parsed
+	case kindBool:
+		parsed, _ := strconv.ParseBool(value)
+		return parsed
+	}
+	return value
+}
+
+// resolveSetting returns the value of a setting and where it came from,
+// skipping the flag which is handled by the command that owns it
+func resolveSetting(key string) (string, string) {
+	return resolveSettingFor("", key)
+}
+
+// resolveSettingFor is like resolveSetting but reads the settings that belong
+// to a profile from the named profile, or the active one when it's empty
+func resolveSettingFor(profile string, key string) (string, string) {
+	setting, err := findSetting(key)
+	if err != nil {
+		return "", ""
+	}
+
+	if setting.Env != "" {
+		if value := os.Getenv(setting.Env); value != "" {
+			return value, "env"
+		}
+	}
+
+	config, err := loadConfig()
+	if err == nil {
+		if setting.Profile {
+			if profile == "" {
+				profile = config.ActiveProfileName()
+			}
+			if value := config.Profile(profile).Get(key); value != "" {
+				return value, "profile:" + profile
+			}
+		} else if value, ok := config.Defaults[key]; ok {
+			return fmt.Sprint(value), "config"
+		}
+	}
+
+	return setting.Default, "default"
+}
+
+func settingString(key string) string {
+	return settingStringFor("", key)
+}
+
+// settingStringFor resolves a setting for the named profile, see
+// resolveSettingFor
+func settingStringFor(profile string, key string) string {
+	value, _ := resolveSettingFor(profile, key)
+	return value
+}
+
+// settingInt resolves an integer setting, falling back to the default when
+// the configured value isn't valid
+func settingInt(key string) int {
+	value := settingString(key)
+	setting, _ := findSetting(key)
+	if setting.validate(value) != nil {
+		value = setting.Default
+	}
+	n, _ := strconv.Atoi(value)
+	return n
+}
+
+func settingBool(key string) bool {
+	value, err := strconv.ParseBool(settingString(key))
+	if err != nil {
+		setting, _ := findSetting(key)
+		value, _ = strconv.ParseBool(setting.Default)
+	}
+	return value
+}
+
+func settingDuration(key string) time.Duration {
+	value, err := time.ParseDuration(settingString(key))
+	if err != nil {
+		setting, _ := findSetting(key)
+		value, _ = time.ParseDuration(setting.Default)
+	}
+	return value
+}
+
+func (p *Profile) Get(key string) string {
+	switch key {
+	case "jwt":
+		return p.JWT
+	case "gateway":
+		return p.Gateway
+	case "group":
+		return p.Group
+	case "api_host":
+		return p.APIHost
+	case "uploads_host":
+		return p.UploadsHost
+	}
+	return ""
+}
+
+func (p *Profile) Set(key string, value string) {
+	switch key {
+	case "jwt":
+		p.JWT = value
+	case "gateway":
+		p.Gateway = value
+	case "group":
+		p.Group = value
+	case "api_host":
+		p.APIHost = value
+	case "uploads_host":
+		p.UploadsHost = value
+	}
+}
@@ -0,0 +1,375 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/mattn/go-isatty"
+)
+
+var quoteEscaper = strings.NewReplacer("\\", "\\\\", `"`, "\\\"")
+
+// UploadStdin uploads what is piped to stdin as a file named options.Name.
+// Content up to the upload threshold is sent as a regular upload, past it
+// the content is streamed with TUS without knowing its length, so nothing
+// is written to disk, unless the server can't defer the length.
+func UploadStdin(options UploadOptions) (UploadResponse, error) {
+	if options.Name == "nil" {
+		return UploadResponse{}, errors.New("--name is required when uploading from stdin")
+	}
+	if isatty.IsTerminal(os.Stdin.Fd()) || isatty.IsCygwinTerminal(os.Stdin.Fd()) {
+		return UploadResponse{}, errors.New("nothing piped to stdin")
+	}
+	if options.MimeType == "" {
+		options.MimeType = "application/octet-stream"
+	}
+
+	threshold := int64(settingInt("upload_threshold"))
+	prefix, err := io.ReadAll(io.LimitReader(os.Stdin, threshold+1))
+	if err != nil {
+		return UploadResponse{}, errors.Join(err, errors.New("failed to read stdin"))
+	}
+
+	if int64(len(prefix)) <= threshold {
+		response, err := uploadBytes(prefix, options)
+		if err != nil || !options.Verify {
+			return response, err
+		}
+		local, err := readerCID(bytes.NewReader(prefix))
+		if err != nil {
+			return UploadResponse{}, err
+		}
+		return response, verifyCID("stdin", local, response)
+	}
+
+	r := io.MultiReader(bytes.NewReader(prefix), os.Stdin)
+	if !options.Verify {
+		return uploadStream(r, options)
+	}
+	// The CID is computed from what is read for the upload
+	w, wait := streamCID()
+	response, err := uploadStream(io.TeeReader(r, w), options)
+	w.CloseWithError(err)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	local, err := wait()
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	return response, verifyCID("stdin", local, response)
+}
+
+func uploadBytes(data []byte, options UploadOptions) (UploadResponse, error) {
+	client, err := NewClient()
+	if err != nil {
+		return UploadResponse{}, err
+	}
+
+	body := &bytes.Buffer{}
+	writer := multipart.NewWriter(body)
+	header := textproto.MIMEHeader{}
+	header.Set("Content-Disposition", fmt.Sprintf(`form-data; name="file"; filename="%s"`, quoteEscaper.Replace(options.Name)))
+	header.Set("Content-Type", options.MimeType)
+	part, err := writer.CreatePart(header)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	_, err = part.Write(data)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	err = writeUploadFields(writer, options, options.Name)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	err = writer.Close()
+	if err != nil {
+		return UploadResponse{}, err
+	}
+
+	payload := body.Bytes()
+	progress := options.progress
+	if progress == nil && options.Verbose {
+		fmt.Printf("Uploading %s (%s)\n", options.Name, formatSize(len(data)))
+		progress = &uploadProgress{bar: newProgressBar(int64(len(payload)))}
+	}
+	getBody := func() (io.ReadCloser, error) {
+		var r io.Reader = bytes.NewReader(payload)
+		if progress != nil {
+			progress.Restart()
+			r = &progressReader{r: r, progress: progress}
+		}
+		return io.NopCloser(r), nil
+	}
+	requestBody, _ := getBody()
+
+	req, err := client.NewRequest("POST", client.UploadsURL+"/v3/files", requestBody)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	req.Header.Set("content-type", writer.FormDataContentType())
+	req.ContentLength = int64(len(payload))
+	req.GetBody = getBody
+
+	var response UploadResponse
+	err = client.DoWithRetry(req, &response)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+
+	return response, nil
+}
+
+// uploadStream uploads r with TUS without knowing its length when the server
+// supports the creation-defer-length extension, otherwise r is written to a
+// temporary file first so its length is known
+func uploadStream(r io.Reader, options UploadOptions) (UploadResponse, error) {
+	client, err := NewClient()
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	if tusSupports(client, "creation-defer-length") {
+		return uploadStreamWithTUS(r, options)
+	}
+	return uploadSpooled(r, options)
+}
+
+// tusSupports tells whether the TUS server lists extension in the
+// Tus-Extension header of its OPTIONS response. Servers that don't answer
+// are assumed not to support it.
+func tusSupports(client *Client, extension string) bool {
+	req, err := client.NewRequest("OPTIONS", client.UploadsURL+"/v3/files", nil)
+	if err != nil {
+		return false
+	}
+	req.Header.Del("content-type")
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	resp, err := client.send(req, true)
+	if err != nil {
+		return false
+	}
+	resp.Body.Close()
+	for _, supported := range strings.Split(resp.Header.Get("Tus-Extension"), ",") {
+		if strings.TrimSpace(supported) == extension {
+			return true
+		}
+	}
+	return false
+}
+
+// uploadSpooled writes r to a temporary file and uploads it with TUS. The
+// file is removed afterwards, so a failed upload can't be resumed and isn't
+// saved either.
+func uploadSpooled(r io.Reader, options UploadOptions) (UploadResponse, error) {
+	if options.Verbose {
+		fmt.Fprintln(os.Stderr, "The server can't receive uploads of unknown length, writing stdin to a temporary file first")
+	}
+	f, err := os.CreateTemp("", "pinata-stdin-*")
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	defer os.Remove(f.Name())
+	_, err = io.Copy(f, r)
+	err = errors.Join(err, f.Close())
+	if err != nil {
+		return UploadResponse{}, errors.Join(err, errors.New("failed to write stdin to a temporary file"))
+	}
+
+	stats, err := os.Stat(f.Name())
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	response, err := uploadWithTUS(f.Name(), options, stats, false)
+	if err != nil {
+		path, _ := filepath.Abs(f.Name())
+		updateUploadRecords(func(records map[string]UploadRecord) {
+			for fingerprint, record := range records {
+				if record.Path == path {
+					delete(records, fingerprint)
+				}
+			}
+		})
+	}
+	return response, err
+}
+
+// uploadStreamWithTUS uploads r with TUS, deferring the length of the upload
+// until the end of r is reached. go-tus needs to know the size and to seek,
+// so the requests are made here: the upload is created and each chunk is
+// read into memory and sent with a PATCH, which can be retried on its own.
+func uploadStreamWithTUS(r io.Reader, options UploadOptions) (UploadResponse, error) {
+	client, err := NewClient()
+	if err != nil {
+		return UploadResponse{}, err
+	}
+
+	metadata, err := tusMetadata(options, options.Name)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+
+	tusURL := client.UploadsURL + "/v3/files"
+	req, err := client.NewRequest("POST", tusURL, nil)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	req.Header.Del("content-type")
+	req.Header.Set("Tus-Resumable", "1.0.0")
+	req.Header.Set("Upload-Defer-Length", "1")
+	req.Header.Set("Upload-Metadata", encodeTUSMetadata(metadata))
+	resp, err := client.send(req, false)
+	if err != nil {
+		return UploadResponse{}, fmt.Errorf("failed to create upload: %w", err)
+	}
+	resp.Body.Close()
+
+	base, err := url.Parse(tusURL)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	location, err := base.Parse(resp.Header.Get("Location"))
+	if err != nil || resp.Header.Get("Location") == "" {
+		return UploadResponse{}, errors.New("failed to create upload: no upload URL returned")
+	}
+	uploadURL := location.String()
+
+	progress := options.progress
+	if progress == nil && options.Verbose {
+		fmt.Printf("Streaming %s\n", options.Name)
+		progress = &uploadProgress{bar: newProgressBar(-1)}
+	}
+
+	in := bufio.NewReader(r)
+	chunk := make([]byte, settingInt("chunk_size"))
+	var offset int64
+	for {
+		n, err := io.ReadFull(in, chunk)
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return UploadResponse{}, errors.Join(err, errors.New("failed to read the upload"))
+		}
+		// The length is sent with the last chunk, which is the one followed by
+		// the end of the stream
+		last := err != nil
+		if !last {
+			_, peekErr := in.Peek(1)
+			last = peekErr == io.EOF
+		}
+
+		length := int64(-1)
+		if last {
+			length = offset + int64(n)
+		}
+		offset, err = patchChunk(client, uploadURL, offset, chunk[:n], length)
+		if err != nil {
+			return UploadResponse{}, fmt.Errorf("failed during upload: %w", err)
+		}
+		if progress != nil {
+			progress.Set(offset)
+		}
+
+		if last {
+			break
+		}
+	}
+	if progress != nil {
+		progress.bar.Finish()
+	}
+
+	urlParts := strings.Split(uploadURL, "/")
+	fileId := urlParts[len(urlParts)-2]
+
+	var response UploadResponse
+	err = client.Get(fmt.Sprintf("/v3/files/%s", fileId), nil, &response)
+	if err != nil {
+		return UploadResponse{}, fmt.Errorf("failed to fetch upload response: %w", err)
+	}
+
+	return response, nil
+}
+
+// patchChunk sends data, which starts at offset, and returns the offset the
+// server has after it. length is sent along when it's known. A failed PATCH
+// may have been partly received, so before it's retried the offset is read
+// again with a HEAD request and only what the server is missing is resent.
+func patchChunk(client *Client, uploadURL string, offset int64, data []byte, length int64) (int64, error) {
+	start := offset
+	end := start + int64(len(data))
+	for attempt := 0; ; attempt++ {
+		patch, err := client.NewRequest("PATCH", uploadURL, bytes.NewReader(data[offset-start:]))
+		if err != nil {
+			return 0, err
+		}
+		patch.Header.Set("content-type", "application/offset+octet-stream")
+		patch.Header.Set("Tus-Resumable", "1.0.0")
+		patch.Header.Set("Upload-Offset", strconv.FormatInt(offset, 10))
+		if length >= 0 {
+			patch.Header.Set("Upload-Length", strconv.FormatInt(length, 10))
+		}
+
+		resp, err := client.send(patch, false)
+		if err == nil {
+			resp.Body.Close()
+			next, err := strconv.ParseInt(resp.Header.Get("Upload-Offset"), 10, 64)
+			if err != nil {
+				return 0, fmt.Errorf("invalid Upload-Offset %q", resp.Header.Get("Upload-Offset"))
+			}
+			if next == end {
+				return next, nil
+			}
+			// The rest of a partly received chunk is sent again
+			if next <= offset || next > end {
+				return 0, fmt.Errorf("the server has offset %d after receiving bytes %d to %d", next, offset, end)
+			}
+			offset = next
+			continue
+		}
+
+		var apiErr *APIError
+		retryable := !errors.As(err, &apiErr) || shouldRetryStatus(apiErr.StatusCode) || apiErr.StatusCode == http.StatusConflict
+		if !retryable || attempt >= client.Retry.MaxRetries {
+			return 0, err
+		}
+		client.Retry.wait(attempt, nil, err.Error())
+
+		offset, err = uploadOffset(client, uploadURL)
+		if err != nil {
+			return 0, fmt.Errorf("failed to read the offset of the upload: %w", err)
+		}
+		if offset < start || offset > end {
+			return 0, fmt.Errorf("the server has offset %d, outside of the chunk from %d to %d", offset, start, end)
+		}
+		// The length still has to be sent when the last chunk was received
+		if offset == end && length < 0 {
+			return offset, nil
+		}
+	}
+}
+
+// encodeTUSMetadata encodes the Upload-Metadata header, sorted so it's stable
+func encodeTUSMetadata(metadata map[string]string) string {
+	keys := make([]string, 0, len(metadata))
+	for key := range metadata {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	pairs := make([]string, len(keys))
+	for i, key := range keys {
+		pairs[i] = key + " " + base64.StdEncoding.EncodeToString([]byte(metadata[key]))
+	}
+	return strings.Join(pairs, ",")
+}
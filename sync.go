@@ -0,0 +1,293 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+// syncPathKey is the keyvalue holding the path of a synced file relative to
+// the synced folder, the name of the file is used when it's missing
+const syncPathKey = "sync_path"
+
+const (
+	syncUpload = "upload"
+	syncUpdate = "update"
+	syncDelete = "delete"
+)
+
+type SyncAction struct {
+	Action string `json:"action"`
+	Path   string `json:"path"`
+	Id     string `json:"id,omitempty"`
+	Cid    string `json:"cid"`
+	Size   int64  `json:"size"`
+	Error  string `json:"error,omitempty"`
+
+	file string
+	// stale are the remote versions of an updated file
+	stale []File
+}
+
+type SyncOptions struct {
+	GroupId   string
+	KeyValues map[string]string
+	Filter    PathFilter
+	// Delete removes the files of the group that aren't in the folder and the
+	// previous versions of updated files
+	Delete      bool
+	DryRun      bool
+	Concurrency int
+}
+
+// SyncFolder mirrors the files of a folder into a group, each file uploaded
+// on its own and named after its path in the folder. Files whose CID didn't
+// change are left alone. The plan is printed to stderr before it's applied.
+func SyncFolder(root string, options SyncOptions) ([]SyncAction, error) {
+	if options.GroupId == "" {
+		return nil, errors.New("no group provided, pass --group or set a group on the profile")
+	}
+	stats, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	if !stats.IsDir() {
+		return nil, fmt.Errorf("%s is not a folder", root)
+	}
+
+	client, err := NewClient()
+	if err != nil {
+		return nil, err
+	}
+	remote, err := listGroupFiles(client, options.GroupId)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list the files of group %s: %w", options.GroupId, err)
+	}
+	files, err := pathsFinder(root, stats, options.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	plan, err := planSync(root, files, remote, options.Delete)
+	if err != nil {
+		return nil, err
+	}
+	plan.print(root, options.GroupId)
+	actions := plan.actions
+	if options.DryRun || len(actions) == 0 {
+		err = render(actions, actions)
+		return actions, err
+	}
+
+	var mu sync.Mutex
+	forEachConcurrently(len(actions), options.Concurrency, func(i int) {
+		err := applySyncAction(client, &actions[i], options)
+		mu.Lock()
+		defer mu.Unlock()
+		if err != nil {
+			actions[i].Error = err.Error()
+			fmt.Fprintf(os.Stderr, "Failed to %s %s: %s\n", actions[i].Action, actions[i].Path, err)
+			return
+		}
+		fmt.Fprintf(os.Stderr, "%s %s\n", syncVerb(actions[i].Action), actions[i].Path)
+	})
+
+	err = render(actions, actions)
+	if err != nil {
+		return nil, err
+	}
+
+	var failed int
+	for _, action := range actions {
+		if action.Error != "" {
+			failed++
+		}
+	}
+	if failed > 0 {
+		return actions, fmt.Errorf("%d of %d sync actions failed", failed, len(actions))
+	}
+	return actions, nil
+}
+
+// listGroupFiles lists every file of a group, following the pages
+func listGroupFiles(client *Client, groupId string) ([]File, error) {
+	var files []File
+	params := url.Values{}
+	params.Set("group", groupId)
+	for {
+		var response ListResponse
+		err := client.Get("/v3/files", params, &response)
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, response.Data.Files...)
+		token := response.Data.NextPageToken
+		if token == "" || len(response.Data.Files) == 0 {
+			return files, nil
+		}
+		params.Set("pageToken", token)
+	}
+}
+
+// remotePath is the path a remote file was synced from
+func remotePath(file File) string {
+	if path, ok := file.KeyValues[syncPathKey].(string); ok && path != "" {
+		return path
+	}
+	return file.Name
+}
+
+type syncPlan struct {
+	actions []SyncAction
+	// unchanged counts the files whose CID is already in the group
+	unchanged int
+	// extra counts the files of the group that are kept although they aren't
+	// in the folder or are older versions
+	extra int
+}
+
+// planSync compares the local files with the files of the group by path and
+// CID
+func planSync(root string, files []string, remote []File, deleteRemote bool) (syncPlan, error) {
+	byPath := map[string][]File{}
+	for _, file := range remote {
+		path := remotePath(file)
+		byPath[path] = append(byPath[path], file)
+	}
+
+	plan := syncPlan{actions: []SyncAction{}}
+	builder := &dagBuilder{}
+	for _, f := range files {
+		rel, err := filepath.Rel(root, f)
+		if err != nil {
+			return syncPlan{}, err
+		}
+		rel = filepath.ToSlash(rel)
+		info, err := os.Stat(f)
+		if err != nil {
+			return syncPlan{}, err
+		}
+		link, err := builder.addFile(f)
+		if err != nil {
+			return syncPlan{}, fmt.Errorf("failed to compute CID of %s: %w", f, err)
+		}
+		local := link.Cid.String()
+
+		versions := byPath[rel]
+		delete(byPath, rel)
+		action := SyncAction{Action: syncUpload, Path: rel, Cid: local, Size: info.Size(), file: f}
+		if len(versions) > 0 {
+			action.Action = syncUpdate
+		}
+		current := false
+		for _, version := range versions {
+			if version.Cid == local && !current {
+				current = true
+				continue
+			}
+			action.stale = append(action.stale, version)
+		}
+		if !deleteRemote {
+			plan.extra += len(action.stale)
+			action.stale = nil
+		}
+		if current {
+			plan.unchanged++
+			// Duplicates of an unchanged file are deleted on their own
+			for _, stale := range action.stale {
+				plan.actions = append(plan.actions, deleteAction(rel, stale))
+			}
+			continue
+		}
+		plan.actions = append(plan.actions, action)
+	}
+
+	if deleteRemote {
+		paths := make([]string, 0, len(byPath))
+		for path := range byPath {
+			paths = append(paths, path)
+		}
+		sort.Strings(paths)
+		for _, path := range paths {
+			for _, file := range byPath[path] {
+				plan.actions = append(plan.actions, deleteAction(path, file))
+			}
+		}
+	} else {
+		for _, versions := range byPath {
+			plan.extra += len(versions)
+		}
+	}
+
+	return plan, nil
+}
+
+func deleteAction(path string, file File) SyncAction {
+	return SyncAction{Action: syncDelete, Path: path, Id: file.Id, Cid: file.Cid, Size: int64(file.Size)}
+}
+
+func (p syncPlan) print(root string, groupId string) {
+	counts := map[string]int{}
+	for _, action := range p.actions {
+		counts[action.Action]++
+	}
+	fmt.Fprintf(os.Stderr, "Syncing %s to group %s: %d to upload, %d to update, %d to delete, %d unchanged\n",
+		root, groupId, counts[syncUpload], counts[syncUpdate], counts[syncDelete], p.unchanged)
+	for _, action := range p.actions {
+		fmt.Fprintf(os.Stderr, "  %-6s  %s (%s)\n", action.Action, action.Path, formatSize(int(action.Size)))
+	}
+	if p.extra > 0 {
+		fmt.Fprintf(os.Stderr, "%d files of the group aren't in the folder or are older versions, use --delete to remove them\n", p.extra)
+	}
+}
+
+func syncVerb(action string) string {
+	switch action {
+	case syncUpload:
+		return "Uploaded"
+	case syncUpdate:
+		return "Updated"
+	}
+	return "Deleted"
+}
+
+// applySyncAction uploads or deletes a file. An update uploads the new version
+// first so the old one is only deleted once it has been replaced.
+func applySyncAction(client *Client, action *SyncAction, options SyncOptions) error {
+	if action.Action == syncDelete {
+		return client.Delete(fmt.Sprintf("/v3/files/%s", action.Id))
+	}
+
+	keyvalues := map[string]string{}
+	for key, value := range options.KeyValues {
+		keyvalues[key] = value
+	}
+	keyvalues[syncPathKey] = action.Path
+	response, err := Upload(action.file, UploadOptions{
+		GroupId:   options.GroupId,
+		Name:      action.Path,
+		KeyValues: keyvalues,
+	})
+	if err != nil {
+		return err
+	}
+	action.Id = response.Data.Id
+	// The previous versions are kept if what was uploaded isn't what was
+	// planned
+	err = verifyCID(action.Path, action.Cid, response)
+	if err != nil {
+		return err
+	}
+
+	for _, stale := range action.stale {
+		err = client.Delete(fmt.Sprintf("/v3/files/%s", stale.Id))
+		if err != nil {
+			return fmt.Errorf("uploaded as %s but failed to delete the previous version %s: %w", action.Id, stale.Id, err)
+		}
+	}
+	return nil
+}
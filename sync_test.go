@@ -0,0 +1,110 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestPlanSync(t *testing.T) {
+	root := t.TempDir()
+	contents := map[string]string{
+		"new.txt":          "new\n",
+		"same.txt":         "same\n",
+		"dup.txt":          "dup\n",
+		"docs/changed.txt": "changed\n",
+	}
+	var files []string
+	cids := map[string]string{}
+	for _, name := range []string{"docs/changed.txt", "dup.txt", "new.txt", "same.txt"} {
+		path := filepath.Join(root, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, []byte(contents[name]), 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+		link, err := (&dagBuilder{}).addFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		files = append(files, path)
+		cids[name] = link.Cid.String()
+	}
+
+	remote := []File{
+		{Id: "same-1", Name: "same.txt", Cid: cids["same.txt"]},
+		// Files uploaded by sync are matched by their sync_path
+		{Id: "changed-1", Name: "changed.txt", Cid: "bafkreiold1", KeyValues: map[string]interface{}{syncPathKey: "docs/changed.txt"}},
+		{Id: "changed-2", Name: "changed.txt", Cid: "bafkreiold2", KeyValues: map[string]interface{}{syncPathKey: "docs/changed.txt"}},
+		{Id: "dup-1", Name: "dup.txt", Cid: cids["dup.txt"]},
+		{Id: "dup-2", Name: "dup.txt", Cid: cids["dup.txt"]},
+		{Id: "gone-1", Name: "gone.txt", Cid: "bafkreigone"},
+	}
+
+	tests := []struct {
+		name         string
+		deleteRemote bool
+		actions      []string
+		unchanged    int
+		extra        int
+	}{
+		{
+			name:         "keep remote files",
+			deleteRemote: false,
+			actions: []string{
+				"update docs/changed.txt",
+				"upload new.txt",
+			},
+			unchanged: 2,
+			extra:     4,
+		},
+		{
+			name:         "delete remote files",
+			deleteRemote: true,
+			actions: []string{
+				"update docs/changed.txt stale changed-1 changed-2",
+				"delete dup.txt dup-2",
+				"upload new.txt",
+				"delete gone.txt gone-1",
+			},
+			unchanged: 2,
+			extra:     0,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			plan, err := planSync(root, files, remote, test.deleteRemote)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var actions []string
+			for _, action := range plan.actions {
+				parts := []string{action.Action, action.Path}
+				if action.Action == syncDelete {
+					parts = append(parts, action.Id)
+				} else if action.Cid != cids[action.Path] {
+					t.Errorf("%s %s: got CID %s, want %s", action.Action, action.Path, action.Cid, cids[action.Path])
+				}
+				if len(action.stale) > 0 {
+					parts = append(parts, "stale")
+					for _, stale := range action.stale {
+						parts = append(parts, stale.Id)
+					}
+				}
+				actions = append(actions, strings.Join(parts, " "))
+			}
+			if !reflect.DeepEqual(actions, test.actions) {
+				t.Errorf("got actions %q, want %q", actions, test.actions)
+			}
+			if plan.unchanged != test.unchanged || plan.extra != test.extra {
+				t.Errorf("got %d unchanged and %d extra, want %d and %d", plan.unchanged, plan.extra, test.unchanged, test.extra)
+			}
+		})
+	}
+}
@@ -14,6 +14,46 @@ type UploadResponse struct {
 	} `json:"data"`
 }
 
+type AuthStatusResponse struct {
+	Profile       string      `json:"profile"`
+	Source        string      `json:"source"`
+	Authenticated bool        `json:"authenticated"`
+	Error         string      `json:"error,omitempty"`
+	UserId        string      `json:"user_id,omitempty"`
+	Email         string      `json:"email,omitempty"`
+	KeyId         string      `json:"key_id,omitempty"`
+	KeyType       string      `json:"key_type,omitempty"`
+	Scopes        interface{} `json:"scopes,omitempty"`
+	IssuedAt      string      `json:"issued_at,omitempty"`
+	ExpiresAt     string      `json:"expires_at,omitempty"`
+	Expired       bool        `json:"expired"`
+	Gateway       string      `json:"gateway,omitempty"`
+	APIHost       string      `json:"api_host"`
+}
+
+// UploadOptions are the settings of an upload, a Name of "nil" uses the name
+// of the file or folder
+type UploadOptions struct {
+	GroupId   string
+	Name      string
+	KeyValues map[string]string
+	// Filter selects the files uploaded from folders
+	Filter PathFilter
+	// MimeType is only used for content uploaded from stdin
+	MimeType string
+	// Verify computes the CID locally and fails if the uploaded one differs
+	Verify bool
+	// SkipExisting doesn't upload content whose CID is already on the account
+	SkipExisting bool
+	// Profile is the profile uploads are made with, the active one when it's
+	// empty
+	Profile string
+	Verbose bool
+	// progress is shared by the uploads of a batch, when it isn't set a
+	// verbose upload shows its own progress bar
+	progress *uploadProgress
+}
+
 type Options struct {
 	GroupId string `json:"group_id"`
 }
@@ -35,7 +75,10 @@ type File struct {
 }
 
 type FileUpdateBody struct {
-	Name string `json:"name"`
+	Name string `json:"name,omitempty"`
+	// KeyValues is a pointer so that removing every keyvalue still sends an
+	// empty map
+	KeyValues *map[string]interface{} `json:"keyvalues,omitempty"`
 }
 
 type GetFileResponse struct {
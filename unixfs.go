@@ -0,0 +1,382 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/base32"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"math/bits"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// The DAG is laid out the way IPFS nodes add files with CIDv1 by default:
+// 256KiB raw leaves, balanced trees of at most 174 links and dag-pb
+// directories, which are sharded into a HAMT once the names and CIDs of
+// their links add up to 256KiB.
+const (
+	dagChunkSize = 256 * 1024
+	dagMaxLinks  = 174
+
+	hamtShardingSize = 256 * 1024
+	hamtFanout       = 256
+	// hamtMaxDepth is reached when the 64 bit hashes of two names are equal
+	hamtMaxDepth = 8
+)
+
+const (
+	codecRaw    = 0x55
+	codecDagPB  = 0x70
+	hashSHA256  = 0x12
+	cidVersion1 = 0x01
+
+	hashMurmur3 = 0x22
+
+	unixfsDirectory = 1
+	unixfsFile      = 2
+	unixfsHAMTShard = 5
+)
+
+var cidEncoding = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// cid is a binary CIDv1 with a sha2-256 multihash
+type cid []byte
+
+func newCID(codec uint64, data []byte) cid {
+	sum := sha256.Sum256(data)
+	c := binary.AppendUvarint(nil, cidVersion1)
+	c = binary.AppendUvarint(c, codec)
+	c = binary.AppendUvarint(c, hashSHA256)
+	c = binary.AppendUvarint(c, uint64(len(sum)))
+	return append(c, sum[:]...)
+}
+
+// String encodes the CID as base32, the default for CIDv1
+func (c cid) String() string {
+	return "b" + strings.ToLower(cidEncoding.EncodeToString(c))
+}
+
+// dagLink points to a node along with the size of the DAG below it, as
+// stored in dag-pb links, and the number of bytes of file data it holds
+type dagLink struct {
+	Name     string
+	Cid      cid
+	Tsize    uint64
+	FileSize uint64
+}
+
+// blockWriter receives every block of a DAG as it is built
+type blockWriter interface {
+	WriteBlock(c cid, data []byte) error
+}
+
+// dagBuilder turns files and folders into UnixFS DAGs. Blocks are passed to
+// out if it is set, otherwise only the CIDs are computed.
+type dagBuilder struct {
+	out blockWriter
+}
+
+func (b *dagBuilder) put(codec uint64, data []byte) (cid, error) {
+	c := newCID(codec, data)
+	if b.out != nil {
+		err := b.out.WriteBlock(c, data)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return c, nil
+}
+
+func (b *dagBuilder) addFile(path string) (dagLink, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return dagLink{}, err
+	}
+	defer f.Close()
+	return b.addReader(f)
+}
+
+// addReader chunks r into raw leaves and links them into a balanced tree.
+// A file that fits in a single chunk is just that leaf.
+func (b *dagBuilder) addReader(r io.Reader) (dagLink, error) {
+	var links []dagLink
+	buf := make([]byte, dagChunkSize)
+	for {
+		n, err := io.ReadFull(r, buf)
+		if err == io.EOF && len(links) > 0 {
+			break
+		}
+		if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+			return dagLink{}, err
+		}
+		c, putErr := b.put(codecRaw, buf[:n])
+		if putErr != nil {
+			return dagLink{}, putErr
+		}
+		links = append(links, dagLink{Cid: c, Tsize: uint64(n), FileSize: uint64(n)})
+		if err != nil {
+			break
+		}
+	}
+
+	for len(links) > 1 {
+		var parents []dagLink
+		for start := 0; start < len(links); start += dagMaxLinks {
+			end := start + dagMaxLinks
+			if end > len(links) {
+				end = len(links)
+			}
+			parent, err := b.fileNode(links[start:end])
+			if err != nil {
+				return dagLink{}, err
+			}
+			parents = append(parents, parent)
+		}
+		links = parents
+	}
+	return links[0], nil
+}
+
+func (b *dagBuilder) fileNode(children []dagLink) (dagLink, error) {
+	var fileSize uint64
+	blockSizes := make([]uint64, len(children))
+	for i, child := range children {
+		fileSize += child.FileSize
+		blockSizes[i] = child.FileSize
+	}
+	data := encodeUnixFS(unixfsFile, fileSize, blockSizes)
+	return b.pbNode(children, data, fileSize)
+}
+
+// addDirectory builds the directory DAG of root from the files found in it
+func (b *dagBuilder) addDirectory(root string, files []string) (dagLink, error) {
+	tree := &dirEntry{children: map[string]*dirEntry{}}
+	for _, f := range files {
+		rel, err := filepath.Rel(root, f)
+		if err != nil {
+			return dagLink{}, err
+		}
+		node := tree
+		parts := strings.Split(filepath.ToSlash(rel), "/")
+		for _, part := range parts[:len(parts)-1] {
+			child, ok := node.children[part]
+			if !ok {
+				child = &dirEntry{children: map[string]*dirEntry{}}
+				node.children[part] = child
+			}
+			node = child
+		}
+		node.children[parts[len(parts)-1]] = &dirEntry{path: f}
+	}
+	return b.addTree(tree)
+}
+
+type dirEntry struct {
+	path     string
+	children map[string]*dirEntry
+}
+
+func (b *dagBuilder) addTree(dir *dirEntry) (dagLink, error) {
+	names := make([]string, 0, len(dir.children))
+	for name := range dir.children {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	links := make([]dagLink, len(names))
+	for i, name := range names {
+		entry := dir.children[name]
+		var link dagLink
+		var err error
+		if entry.children != nil {
+			link, err = b.addTree(entry)
+		} else {
+			link, err = b.addFile(entry.path)
+		}
+		if err != nil {
+			return dagLink{}, err
+		}
+		link.Name = name
+		links[i] = link
+	}
+
+	var size int
+	for _, link := range links {
+		size += len(link.Name) + len(link.Cid)
+	}
+	if size >= hamtShardingSize {
+		return b.addShard(links, 0)
+	}
+	return b.pbNode(links, encodeUnixFS(unixfsDirectory, 0, nil), 0)
+}
+
+// addShard builds a HAMT shard of a directory at depth. Each link goes to
+// the slot picked by the byte of the hash of its name at that depth, a slot
+// with several links gets a shard of its own one level deeper. Links are
+// named with the slot as two uppercase hex digits, followed by the name for
+// the links to the entries.
+func (b *dagBuilder) addShard(links []dagLink, depth int) (dagLink, error) {
+	if depth >= hamtMaxDepth {
+		return dagLink{}, fmt.Errorf("can't shard directory entries %q and %q, their names have the same hash", links[0].Name, links[1].Name)
+	}
+
+	var slots [hamtFanout][]dagLink
+	for _, link := range links {
+		slot := murmur3Hash([]byte(link.Name))[depth]
+		slots[slot] = append(slots[slot], link)
+	}
+
+	var children []dagLink
+	bitfield := make([]byte, hamtFanout/8)
+	for i, slot := range slots {
+		if len(slot) == 0 {
+			continue
+		}
+		bitfield[len(bitfield)-1-i/8] |= 1 << (i % 8)
+		prefix := fmt.Sprintf("%02X", i)
+		if len(slot) == 1 {
+			child := slot[0]
+			child.Name = prefix + child.Name
+			children = append(children, child)
+			continue
+		}
+		child, err := b.addShard(slot, depth+1)
+		if err != nil {
+			return dagLink{}, err
+		}
+		child.Name = prefix
+		children = append(children, child)
+	}
+
+	// The bitfield is stored without its leading zero bytes
+	for len(bitfield) > 0 && bitfield[0] == 0 {
+		bitfield = bitfield[1:]
+	}
+	data := appendProtoVarint(nil, 1, unixfsHAMTShard)
+	data = appendProtoBytes(data, 2, bitfield)
+	data = appendProtoVarint(data, 5, hashMurmur3)
+	data = appendProtoVarint(data, 6, hamtFanout)
+	return b.pbNode(children, data, 0)
+}
+
+func (b *dagBuilder) pbNode(links []dagLink, data []byte, fileSize uint64) (dagLink, error) {
+	node := encodePBNode(links, data)
+	c, err := b.put(codecDagPB, node)
+	if err != nil {
+		return dagLink{}, err
+	}
+	tsize := uint64(len(node))
+	for _, link := range links {
+		tsize += link.Tsize
+	}
+	return dagLink{Cid: c, Tsize: tsize, FileSize: fileSize}, nil
+}
+
+// encodePBNode writes a dag-pb node, links first as the spec requires
+func encodePBNode(links []dagLink, data []byte) []byte {
+	var node []byte
+	for _, link := range links {
+		var l []byte
+		l = appendProtoBytes(l, 1, link.Cid)
+		l = appendProtoBytes(l, 2, []byte(link.Name))
+		l = appendProtoVarint(l, 3, link.Tsize)
+		node = appendProtoBytes(node, 2, l)
+	}
+	return appendProtoBytes(node, 1, data)
+}
+
+func encodeUnixFS(kind uint64, fileSize uint64, blockSizes []uint64) []byte {
+	data := appendProtoVarint(nil, 1, kind)
+	if kind == unixfsFile {
+		data = appendProtoVarint(data, 3, fileSize)
+		for _, size := range blockSizes {
+			data = appendProtoVarint(data, 4, size)
+		}
+	}
+	return data
+}
+
+// murmur3Hash is the first half of the 128 bit x64 murmur3 hash with a seed
+// of 0, big endian, which is what HAMT shards hash names with
+func murmur3Hash(data []byte) []byte {
+	const (
+		c1 = 0x87c37b91114253d5
+		c2 = 0x4cf5ad432745937f
+	)
+	var h1, h2 uint64
+
+	n := len(data) / 16 * 16
+	for i := 0; i < n; i += 16 {
+		k1 := binary.LittleEndian.Uint64(data[i:])
+		k2 := binary.LittleEndian.Uint64(data[i+8:])
+
+		k1 *= c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= c2
+		h1 ^= k1
+		h1 = bits.RotateLeft64(h1, 27)
+		h1 += h2
+		h1 = h1*5 + 0x52dce729
+
+		k2 *= c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= c1
+		h2 ^= k2
+		h2 = bits.RotateLeft64(h2, 31)
+		h2 += h1
+		h2 = h2*5 + 0x38495ab5
+	}
+
+	var k1, k2 uint64
+	tail := data[n:]
+	for i := len(tail) - 1; i >= 8; i-- {
+		k2 ^= uint64(tail[i]) << ((i - 8) * 8)
+	}
+	if len(tail) > 8 {
+		k2 *= c2
+		k2 = bits.RotateLeft64(k2, 33)
+		k2 *= c1
+		h2 ^= k2
+	}
+	for i := min(len(tail), 8) - 1; i >= 0; i-- {
+		k1 ^= uint64(tail[i]) << (i * 8)
+	}
+	if len(tail) > 0 {
+		k1 *= c1
+		k1 = bits.RotateLeft64(k1, 31)
+		k1 *= c2
+		h1 ^= k1
+	}
+
+	h1 ^= uint64(len(data))
+	h2 ^= uint64(len(data))
+	h1 += h2
+	h2 += h1
+	h1 = fmix64(h1)
+	h2 = fmix64(h2)
+	h1 += h2
+	return binary.BigEndian.AppendUint64(nil, h1)
+}
+
+func fmix64(k uint64) uint64 {
+	k ^= k >> 33
+	k *= 0xff51afd7ed558ccd
+	k ^= k >> 33
+	k *= 0xc4ceb9fe1a85ec53
+	k ^= k >> 33
+	return k
+}
+
+func appendProtoVarint(buf []byte, field uint64, value uint64) []byte {
+	buf = binary.AppendUvarint(buf, field<<3)
+	return binary.AppendUvarint(buf, value)
+}
+
+func appendProtoBytes(buf []byte, field uint64, value []byte) []byte {
+	buf = binary.AppendUvarint(buf, field<<3|2)
+	buf = binary.AppendUvarint(buf, uint64(len(value)))
+	return append(buf, value...)
+}
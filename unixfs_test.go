@@ -0,0 +1,129 @@
+package main
+
+import (
+	"bytes"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// The expected CIDs and sizes were produced by boxo v0.21.0, the library
+// IPFS nodes add content with, using raw leaves and CIDv1
+
+// testData is n bytes of a pattern that doesn't repeat at chunk boundaries
+func testData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i % 251)
+	}
+	return data
+}
+
+func TestAddReader(t *testing.T) {
+	tests := []struct {
+		size  int
+		cid   string
+		tsize uint64
+	}{
+		{0, "bafkreihdwdcefgh4dqkjv67uzcmw7ojee6xedzdetojuzjevtenxquvyku", 0},
+		{1, "bafkreidogqfzz75tpkmjzjke425xqcrmpcib2p5tg44hnbirumdbpl5adu", 1},
+		{dagChunkSize, "bafkreibruh455iawsviqslif5c7uurdcfdemh22mtnytyzvnzn75kpejxy", 262144},
+		{dagChunkSize + 1, "bafybeiexg2oqkfnj56l7fcmawswqbijt5shq4b5rg6a546uwpkqqzwjioi", 262249},
+		{dagMaxLinks * dagChunkSize, "bafybeihpe5snhzneq7xs53nivmsopto5lrogo3wjynauqylqeym5a3irbm", 45621766},
+		{dagMaxLinks*dagChunkSize + 1, "bafybeib4y7ghw2rq7bracc4xwtxrbzo7cfvagdpte2tmrkgwl6dyard3cm", 45621926},
+	}
+	for _, test := range tests {
+		link, err := (&dagBuilder{}).addReader(bytes.NewReader(testData(test.size)))
+		if err != nil {
+			t.Fatalf("size %d: %s", test.size, err)
+		}
+		if link.Cid.String() != test.cid || link.Tsize != test.tsize {
+			t.Errorf("size %d: got %s (%d), want %s (%d)", test.size, link.Cid, link.Tsize, test.cid, test.tsize)
+		}
+	}
+}
+
+func TestAddDirectory(t *testing.T) {
+	tests := []struct {
+		name  string
+		count int
+		path  func(i int) string
+		cid   string
+		tsize uint64
+	}{
+		{
+			// The names and CIDs of the links add up to 1 byte less than the
+			// sharding size
+			name:  "under sharding size",
+			count: 4095,
+			path:  func(i int) string { return fmt.Sprintf("entry-%022d", i) },
+			cid:   "bafybeiebgcrsehchkwx7n4rgs3brfmruralwokvklmmb62wkgj3gdonade",
+			tsize: 314209,
+		},
+		{
+			name:  "at sharding size",
+			count: 4096,
+			path:  func(i int) string { return fmt.Sprintf("entry-%022d", i) },
+			cid:   "bafybeibogktfvh5swn6nyl4ds3jnqenitopweatpo4b45gtpsv2253g2cm",
+			tsize: 355005,
+		},
+		{
+			name:  "sharded",
+			count: 5000,
+			path:  func(i int) string { return fmt.Sprintf("file-%d.txt", i) },
+			cid:   "bafybeigvzmcc2mxm7prmvexhbpl4mh3iu5wvuw4ruq2hanrnjyiecis3yy",
+			tsize: 307784,
+		},
+		{
+			name:  "sharded with subfolders",
+			count: 6000,
+			path:  func(i int) string { return fmt.Sprintf("dir-%d/file-%05d.txt", i%3, i) },
+			cid:   "bafybeifygzeoiysajhcvz5ay7omvt5vus2q7jl4xf6j7y3zjgxkudryiyq",
+			tsize: 377059,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			root := t.TempDir()
+			files := make([]string, test.count)
+			for i := range files {
+				files[i] = filepath.Join(root, test.path(i))
+				err := os.MkdirAll(filepath.Dir(files[i]), 0755)
+				if err != nil {
+					t.Fatal(err)
+				}
+				err = os.WriteFile(files[i], []byte(fmt.Sprintf("%d\n", i)), 0644)
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			link, err := (&dagBuilder{}).addDirectory(root, files)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if link.Cid.String() != test.cid || link.Tsize != test.tsize {
+				t.Errorf("got %s (%d), want %s (%d)", link.Cid, link.Tsize, test.cid, test.tsize)
+			}
+		})
+	}
+}
+
+func TestMurmur3Hash(t *testing.T) {
+	tests := map[string]string{
+		"":                    "0000000000000000",
+		"a":                   "85555565f6597889",
+		"hello":               "cbd8a7b341bd9b02",
+		"file-00000.txt":      "19698b1c0fa73e79",
+		"0123456789abcdef":    "4be06d94cf4ad1a7",
+		"0123456789abcdefXYZ": "99d375026c4a901d",
+	}
+	for input, want := range tests {
+		got := hex.EncodeToString(murmur3Hash([]byte(input)))
+		if got != want {
+			t.Errorf("murmur3Hash(%q) = %s, want %s", input, got, want)
+		}
+	}
+}
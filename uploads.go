@@ -1,17 +1,16 @@
 package main
 
 import (
-	"bytes"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"io"
-	"log"
 	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/eventials/go-tus"
@@ -19,32 +18,238 @@ import (
 )
 
 const (
-	MAX_SIZE_REGULAR_UPLOAD = 100 * 1024 * 1024 // Uploead threshold
-	CHUNK_SIZE              = 10 * 1024 * 1024  // Chunk size
+	MAX_SIZE_REGULAR_UPLOAD = 100 * 1024 * 1024 // Default upload threshold, see the upload_threshold setting
+	CHUNK_SIZE              = 10 * 1024 * 1024  // Default chunk size, see the chunk_size setting
 )
 
-func Upload(filePath string, groupId string, name string, verbose bool) (UploadResponse, error) {
+func Upload(filePath string, options UploadOptions) (UploadResponse, error) {
+	if !options.Verify && !options.SkipExisting {
+		return uploadPath(filePath, options)
+	}
 
+	// Folders large enough to be sharded get the CID of their HAMT, which is
+	// what an existing upload of them has
+	local, err := pathCID(filePath, options.Filter)
+	if err != nil {
+		return UploadResponse{}, fmt.Errorf("failed to compute CID: %w", err)
+	}
+	if options.SkipExisting {
+		response, found, err := existingUpload(local.Cid, options)
+		if err != nil {
+			return UploadResponse{}, err
+		}
+		if found {
+			fmt.Fprintf(os.Stderr, "Skipped %s, already uploaded as %s\n", filePath, response.Data.Id)
+			return response, nil
+		}
+	}
+
+	response, err := uploadPath(filePath, options)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	if options.Verify {
+		err = verifyCID(filePath, local.Cid, response)
+		if err != nil {
+			return response, err
+		}
+		if options.Verbose {
+			fmt.Printf("Verified CID %s\n", local.Cid)
+		}
+	}
+	return response, nil
+}
+
+// existingUpload looks for a file of the account with the CID of the content
+// to upload and adds it to the group of the upload if it isn't in it
+func existingUpload(cid string, options UploadOptions) (UploadResponse, bool, error) {
+	client, err := NewClient()
+	if err != nil {
+		return UploadResponse{}, false, err
+	}
+	file, err := findFileByCID(client, cid)
+	if err != nil {
+		return UploadResponse{}, false, fmt.Errorf("failed to look for existing files: %w", err)
+	}
+	if file == nil {
+		return UploadResponse{}, false, nil
+	}
+
+	if options.GroupId != "" && (file.GroupId == nil || *file.GroupId != options.GroupId) {
+		err = client.Put(fmt.Sprintf("/v3/files/groups/%s/ids/%s", options.GroupId, file.Id), nil, nil)
+		if err != nil {
+			return UploadResponse{}, false, fmt.Errorf("failed to add existing file %s to group: %w", file.Id, err)
+		}
+		file.GroupId = &options.GroupId
+	}
+
+	var response UploadResponse
+	response.Data.Id = file.Id
+	response.Data.Name = file.Name
+	response.Data.Cid = file.Cid
+	response.Data.Size = file.Size
+	response.Data.NumberOfFiles = file.NumberOfFiles
+	response.Data.MimeType = file.MimeType
+	response.Data.CreatedAt = file.CreatedAt
+	if file.GroupId != nil {
+		response.Data.GroupId = *file.GroupId
+	}
+	response.Data.IsDuplicate = true
+	return response, true, nil
+}
+
+func uploadPath(filePath string, options UploadOptions) (UploadResponse, error) {
 	stats, err := os.Stat(filePath)
 	if err != nil {
 		return UploadResponse{}, err
 	}
 
-	if stats.Size() > MAX_SIZE_REGULAR_UPLOAD {
-		return uploadWithTUS(filePath, groupId, name, verbose, stats)
+	threshold := int64(settingInt("upload_threshold"))
+	if stats.IsDir() {
+		files, err := pathsFinder(filePath, stats, options.Filter)
+		if err != nil {
+			return UploadResponse{}, err
+		}
+		size, err := filesSize(files)
+		if err != nil {
+			return UploadResponse{}, err
+		}
+		if size > threshold {
+			return uploadDirectoryAsCAR(filePath, files, options, stats)
+		}
+		return regularUpload(filePath, options)
+	}
+
+	if stats.Size() > threshold {
+		return uploadWithTUS(filePath, options, stats, false)
+	}
+
+	return regularUpload(filePath, options)
+}
+
+// uploadDirectoryAsCAR packs a folder that is too large for a regular upload
+// into a CAR and sends it with TUS, so it is read from disk in chunks and can
+// be resumed like a large file
+func uploadDirectoryAsCAR(filePath string, files []string, options UploadOptions, stats os.FileInfo) (UploadResponse, error) {
+	if options.Verbose {
+		fmt.Printf("Packing %d files from %s into a CAR\n", len(files), stats.Name())
+	}
+	carPath, err := writeDirectoryCAR(filePath, files)
+	if err != nil {
+		return UploadResponse{}, fmt.Errorf("failed to pack folder: %w", err)
+	}
+	carStats, err := os.Stat(carPath)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+
+	if options.Name == "nil" {
+		options.Name = stats.Name()
 	}
+	response, err := uploadWithTUS(carPath, options, carStats, true)
+	if err != nil {
+		// The CAR is only kept if the upload was saved to be resumed
+		saved, savedErr := savedCARs()
+		if absPath, _ := filepath.Abs(carPath); savedErr == nil && !saved[absPath] {
+			os.Remove(carPath)
+		}
+		return UploadResponse{}, err
+	}
+
+	os.Remove(carPath)
+	return response, nil
+}
 
-	return regularUpload(filePath, groupId, name, verbose)
+// parseKeyValues reads the keyvalues of an upload from a JSON file of string
+// values, if one is given, and key=value pairs which take precedence
+func parseKeyValues(pairs []string, file string) (map[string]string, error) {
+	keyvalues := map[string]string{}
+
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, err
+		}
+		var values map[string]interface{}
+		err = json.Unmarshal(data, &values)
+		if err != nil {
+			return nil, fmt.Errorf("keyvalues file %s must be a JSON object: %w", file, err)
+		}
+		for key, value := range values {
+			switch v := value.(type) {
+			case string:
+				keyvalues[key] = v
+			case float64, bool:
+				keyvalues[key] = fmt.Sprint(v)
+			default:
+				return nil, fmt.Errorf("keyvalue %q in %s must be a string, number or boolean", key, file)
+			}
+		}
+	}
+
+	for _, pair := range pairs {
+		key, value, ok := strings.Cut(pair, "=")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid keyvalue %q, use key=value", pair)
+		}
+		keyvalues[key] = value
+	}
+
+	return keyvalues, nil
+}
+
+func filesSize(files []string) (int64, error) {
+	var size int64
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return 0, err
+		}
+		size += info.Size()
+	}
+	return size, nil
 }
 
 type progressReader struct {
-	r   io.Reader
-	bar *progressbar.ProgressBar
+	r        io.Reader
+	progress *uploadProgress
 }
 
-func regularUpload(filePath string, groupId string, name string, verbose bool) (UploadResponse, error) {
+// uploadProgress reports the bytes sent by one upload to a progress bar that
+// may be shared by a batch of uploads, so a retried upload takes back what it
+// had sent instead of resetting the bar
+type uploadProgress struct {
+	bar  *progressbar.ProgressBar
+	mu   sync.Mutex
+	sent int64
+}
+
+func (p *uploadProgress) Add(n int64) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.sent += n
+	p.bar.Add64(n)
+}
+
+// Set moves the progress to offset, for uploads that report how much the
+// server has rather than what was written
+func (p *uploadProgress) Set(offset int64) {
+	p.Add(offset - p.Sent())
+}
+
+func (p *uploadProgress) Sent() int64 {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.sent
+}
+
+func (p *uploadProgress) Restart() {
+	p.Set(0)
+}
 
-	jwt, err := findToken()
+func regularUpload(filePath string, options UploadOptions) (UploadResponse, error) {
+
+	client, err := NewClient()
 	if err != nil {
 		return UploadResponse{}, err
 	}
@@ -53,57 +258,54 @@ func regularUpload(filePath string, groupId string, name string, verbose bool) (
 		fmt.Println("File or folder does not exist")
 		return UploadResponse{}, errors.Join(err, errors.New("file or folder does not exist"))
 	}
-	files, err := pathsFinder(filePath, stats)
+	files, err := pathsFinder(filePath, stats, options.Filter)
 	if err != nil {
 		return UploadResponse{}, err
 	}
-	body := &bytes.Buffer{}
-	contentType, err := createMultipartRequest(filePath, files, body, stats, groupId, name)
+	body, err := newMultipartBody(filePath, files, stats, options)
 	if err != nil {
 		return UploadResponse{}, err
 	}
-
-	var requestBody io.Reader
-	if !verbose {
-		requestBody = body
-	} else {
-		totalSize := int64(body.Len())
-		fmt.Printf("Uploading %s (%s)\n", stats.Name(), formatSize(int(totalSize)))
-		requestBody = newProgressReader(body, totalSize)
-	}
-
-	url := fmt.Sprintf("https://uploads.pinata.cloud/v3/files")
-	req, err := http.NewRequest("POST", url, requestBody)
+	size, err := body.Size()
 	if err != nil {
-		return UploadResponse{}, errors.Join(err, errors.New("failed to create the request"))
+		return UploadResponse{}, err
 	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-	req.Header.Set("content-type", contentType)
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		return UploadResponse{}, errors.Join(err, errors.New("failed to send the request"))
-	}
-	if resp.StatusCode != 200 {
-		return UploadResponse{}, fmt.Errorf("server Returned an error %d", resp.StatusCode)
+	// Progress counts the bytes of the files rather than the whole form, so
+	// a batch can add up the size of its paths
+	if body.progress == nil && options.Verbose {
+		contentSize, err := filesSize(files)
+		if err != nil {
+			return UploadResponse{}, err
+		}
+		fmt.Printf("Uploading %s (%s)\n", stats.Name(), formatSize(int(contentSize)))
+		body.progress = &uploadProgress{bar: newProgressBar(contentSize)}
 	}
 
-	defer resp.Body.Close()
+	// The body is streamed again for every attempt so a retried upload starts
+	// from the beginning and the progress is restarted with it
+	getBody := func() (io.ReadCloser, error) {
+		if body.progress != nil {
+			body.progress.Restart()
+		}
+		return body.Reader(), nil
+	}
+	requestBody, _ := getBody()
 
-	var response UploadResponse
-	err = json.NewDecoder(resp.Body).Decode(&response)
+	req, err := client.NewRequest("POST", client.UploadsURL+"/v3/files", requestBody)
 	if err != nil {
 		return UploadResponse{}, err
 	}
+	req.Header.Set("content-type", body.ContentType())
+	req.ContentLength = size
+	req.GetBody = getBody
 
-	formattedJSON, err := json.MarshalIndent(response.Data, "", "    ")
+	var response UploadResponse
+	err = client.DoWithRetry(req, &response)
 	if err != nil {
-		return UploadResponse{}, errors.New("failed to format JSON")
+		return UploadResponse{}, err
 	}
 
-	fmt.Println(string(formattedJSON))
-
 	return response, nil
 }
 
@@ -111,8 +313,8 @@ func cmpl() {
 	fmt.Println()
 }
 
-func newProgressReader(r io.Reader, size int64) *progressReader {
-	bar := progressbar.NewOptions64(
+func newProgressBar(size int64) *progressbar.ProgressBar {
+	return progressbar.NewOptions64(
 		size,
 		progressbar.OptionEnableColorCodes(true),
 		progressbar.OptionShowBytes(true),
@@ -125,18 +327,11 @@ func newProgressReader(r io.Reader, size int64) *progressReader {
 		}),
 		progressbar.OptionOnCompletion(cmpl),
 	)
-	return &progressReader{r: r, bar: bar}
 }
 
 func (pr *progressReader) Read(p []byte) (n int, err error) {
 	n, err = pr.r.Read(p)
-	if err != nil {
-		return 0, err
-	}
-	err = pr.bar.Add(n)
-	if err != nil {
-		return 0, err
-	}
+	pr.progress.Add(int64(n))
 	return
 }
 
@@ -163,21 +358,88 @@ func formatSize(bytes int) string {
 	return formattedSize
 }
 
-func uploadWithTUS(filePath string, groupId string, name string, verbose bool, stats os.FileInfo) (UploadResponse, error) {
-	jwt, err := findToken()
+// tusMetadata is the TUS counterpart of writeUploadFields
+func tusMetadata(options UploadOptions, name string) (map[string]string, error) {
+	metadata := map[string]string{
+		"filename": name,
+	}
+	if options.GroupId != "" {
+		metadata["group_id"] = options.GroupId
+	}
+	if options.MimeType != "" {
+		metadata["filetype"] = options.MimeType
+	}
+	if len(options.KeyValues) > 0 {
+		keyvalues, err := json.Marshal(options.KeyValues)
+		if err != nil {
+			return nil, err
+		}
+		metadata["keyvalues"] = string(keyvalues)
+	}
+	return metadata, nil
+}
+
+// uploadWithTUS uploads a file in chunks, car marks it as a CAR that the
+// server imports instead of storing as is
+func uploadWithTUS(filePath string, options UploadOptions, stats os.FileInfo, car bool) (UploadResponse, error) {
+	client, err := NewClientForProfile(options.Profile)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+
+	// Create metadata
+	name := filepath.Base(filePath)
+	if options.Name != "nil" {
+		name = options.Name
+	}
+	metadata, err := tusMetadata(options, name)
 	if err != nil {
 		return UploadResponse{}, err
 	}
+	if car {
+		metadata["car"] = "true"
+	}
+
+	fingerprint, err := uploadFingerprint(filePath, stats, client.UploadsURL, metadata)
+	if err != nil {
+		return UploadResponse{}, fmt.Errorf("failed to fingerprint file: %w", err)
+	}
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return UploadResponse{}, err
+	}
+	profile := options.Profile
+	if profile == "" {
+		config, err := loadConfig()
+		if err != nil {
+			return UploadResponse{}, err
+		}
+		profile = config.ActiveProfileName()
+	}
+	// Uploads are saved to disk so running the same upload again resumes it
+	store := &uploadStore{record: UploadRecord{
+		Path:      absPath,
+		Size:      stats.Size(),
+		GroupId:   options.GroupId,
+		KeyValues: options.KeyValues,
+		Profile:   profile,
+		Car:       car,
+	}}
+	if options.Name != "nil" {
+		store.record.Name = options.Name
+	}
 
 	// Create the TUS client with config
-	config := &tus.Config{
-		ChunkSize:  CHUNK_SIZE, // 50MB chunks
-		Resume:     false,
-		Header:     http.Header{"Authorization": {fmt.Sprintf("Bearer %s", jwt)}},
-		HttpClient: http.DefaultClient,
+	tusConfig := &tus.Config{
+		ChunkSize:  int64(settingInt("chunk_size")),
+		Resume:     true,
+		Store:      store,
+		Header:     http.Header{"Authorization": {fmt.Sprintf("Bearer %s", client.JWT)}},
+		HttpClient: client.HTTPClient,
 	}
 
-	client, err := tus.NewClient("https://uploads.pinata.cloud/v3/files", config)
+	tusURL := client.UploadsURL + "/v3/files"
+	tusClient, err := tus.NewClient(tusURL, tusConfig)
 	if err != nil {
 		return UploadResponse{}, fmt.Errorf("failed to create TUS client: %w", err)
 	}
@@ -189,61 +451,51 @@ func uploadWithTUS(filePath string, groupId string, name string, verbose bool, s
 	}
 	defer f.Close()
 
-	// Create metadata
-	metadata := map[string]string{
-		"filename": filepath.Base(filePath),
-	}
-	if groupId != "" {
-		metadata["group_id"] = groupId
-	}
-	if name != "nil" {
-		metadata["filename"] = name
-	}
-
 	// Create the upload
-	upload := tus.NewUpload(f, stats.Size(), metadata, "")
+	upload := tus.NewUpload(f, stats.Size(), metadata, fingerprint)
 
-	// Create and configure the uploader
-	uploader, err := client.CreateUpload(upload)
+	// Resume the saved upload if there is one, otherwise create it
+	uploader, err := tusClient.CreateOrResumeUpload(upload)
 	if err != nil {
-		return UploadResponse{}, fmt.Errorf("failed to create upload: %w", err)
-	}
-
-	var bar *progressbar.ProgressBar
-	if verbose {
-		fmt.Printf("Starting upload of %s (%s)\n", stats.Name(), formatSize(int(stats.Size())))
-		bar = progressbar.NewOptions64(
-			stats.Size(),
-			progressbar.OptionEnableColorCodes(true),
-			progressbar.OptionShowBytes(true),
-			progressbar.OptionSetDescription("Uploading..."),
-			progressbar.OptionSetTheme(progressbar.Theme{
-				Saucer:        "█",
-				SaucerPadding: " ",
-				BarStart:      "|",
-				BarEnd:        "|",
-			}),
-			progressbar.OptionOnCompletion(cmpl),
-		)
+		return UploadResponse{}, fmt.Errorf("failed to create upload: %w", tusError(err, "POST", tusURL))
+	}
+	if uploader.Offset() > 0 {
+		fmt.Fprintf(os.Stderr, "Resuming upload of %s from %s\n", metadata["filename"], formatSize(int(uploader.Offset())))
+	}
 
+	progress := options.progress
+	if progress == nil && options.Verbose {
+		fmt.Printf("Starting upload of %s (%s)\n", metadata["filename"], formatSize(int(stats.Size())))
+		progress = &uploadProgress{bar: newProgressBar(stats.Size())}
+	}
+	if progress != nil {
+		done := make(chan struct{})
+		defer close(done)
 		go func() {
+			ticker := time.NewTicker(100 * time.Millisecond)
+			defer ticker.Stop()
 			for {
-				offset := uploader.Offset()
-				if offset >= stats.Size() {
+				select {
+				case <-done:
 					return
+				case <-ticker.C:
+					progress.Set(uploader.Offset())
 				}
-				bar.Set64(offset)
-				time.Sleep(100 * time.Millisecond)
 			}
 		}()
 	}
 
 	err = uploader.Upload()
 	if err != nil {
-		return UploadResponse{}, fmt.Errorf("failed during upload: %w", err)
+		return UploadResponse{}, fmt.Errorf("failed during upload: %w", tusError(err, "PATCH", uploader.Url()))
+	}
+	if progress != nil {
+		progress.Set(stats.Size())
 	}
 
-	if verbose {
+	store.Delete(fingerprint)
+
+	if options.Verbose {
 		fmt.Println("\nUpload completed!")
 	}
 
@@ -251,99 +503,178 @@ func uploadWithTUS(filePath string, groupId string, name string, verbose bool, s
 	urlParts := strings.Split(uploadURL, "/")
 	fileId := urlParts[len(urlParts)-2]
 
-	apiURL := fmt.Sprintf("https://api.pinata.cloud/v3/files/%s", fileId)
-	req, err := http.NewRequest("GET", apiURL, nil)
-	if err != nil {
-		return UploadResponse{}, fmt.Errorf("failed to create response request: %w", err)
-	}
-	req.Header.Set("Authorization", "Bearer "+string(jwt))
-
-	resp, err := http.DefaultClient.Do(req)
+	var response UploadResponse
+	err = client.Get(fmt.Sprintf("/v3/files/%s", fileId), nil, &response)
 	if err != nil {
 		return UploadResponse{}, fmt.Errorf("failed to fetch upload response: %w", err)
 	}
-	defer resp.Body.Close()
 
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		return UploadResponse{}, fmt.Errorf("failed to read response body: %w", err)
-	}
+	return response, nil
+}
 
-	var response UploadResponse
-	err = json.Unmarshal(body, &response)
-	if err != nil {
-		return UploadResponse{}, fmt.Errorf("failed to parse response: %w", err)
-	}
+// multipartBody streams the multipart form of a regular upload. Files are
+// opened one at a time while they are copied into the request, so memory use
+// doesn't grow with the size of the upload.
+type multipartBody struct {
+	root     string
+	files    []string
+	sizes    []int64
+	stats    os.FileInfo
+	options  UploadOptions
+	boundary string
+	progress *uploadProgress
+}
+
+func newMultipartBody(filePath string, files []string, stats os.FileInfo, options UploadOptions) (*multipartBody, error) {
+	sizes := make([]int64, len(files))
+	for i, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			return nil, err
+		}
+		sizes[i] = info.Size()
+	}
+
+	return &multipartBody{
+		root:     filePath,
+		files:    files,
+		sizes:    sizes,
+		stats:    stats,
+		options:  options,
+		progress: options.progress,
+		// The boundary is kept for every attempt so the computed size stays valid
+		boundary: multipart.NewWriter(io.Discard).Boundary(),
+	}, nil
+}
+
+func (b *multipartBody) ContentType() string {
+	return "multipart/form-data; boundary=" + b.boundary
+}
 
-	formattedJSON, err := json.MarshalIndent(response.Data, "", "    ")
+// Size returns the length of the body by writing the form without the file
+// contents and adding the file sizes instead
+func (b *multipartBody) Size() (int64, error) {
+	counter := &countingWriter{}
+	err := b.write(counter, func(part io.Writer, i int) error {
+		counter.n += b.sizes[i]
+		return nil
+	})
 	if err != nil {
-		return UploadResponse{}, fmt.Errorf("failed to format response: %w", err)
+		return 0, err
 	}
-	fmt.Println(string(formattedJSON))
-
-	return response, nil
+	return counter.n, nil
 }
 
-func createMultipartRequest(filePath string, files []string, body io.Writer, stats os.FileInfo, groupId string, name string) (string, error) {
-	contentType := ""
-	writer := multipart.NewWriter(body)
+// Reader returns a new stream of the body. Closing it stops the goroutine
+// writing the form.
+func (b *multipartBody) Reader() io.ReadCloser {
+	pr, pw := io.Pipe()
+	go func() {
+		pw.CloseWithError(b.write(pw, b.copyFile))
+	}()
+	return pr
+}
 
-	fileIsASingleFile := !stats.IsDir()
-	for _, f := range files {
-		file, err := os.Open(f)
-		if err != nil {
-			return contentType, err
-		}
-		defer func(file *os.File) {
-			err := file.Close()
-			if err != nil {
-				log.Fatal("could not close file")
-			}
-		}(file)
+func (b *multipartBody) write(w io.Writer, writeFile func(part io.Writer, i int) error) error {
+	writer := multipart.NewWriter(w)
+	err := writer.SetBoundary(b.boundary)
+	if err != nil {
+		return err
+	}
 
+	fileIsASingleFile := !b.stats.IsDir()
+	for i, f := range b.files {
 		var part io.Writer
 		if fileIsASingleFile {
 			part, err = writer.CreateFormFile("file", filepath.Base(f))
 		} else {
-			relPath, _ := filepath.Rel(filePath, f)
-			part, err = writer.CreateFormFile("file", filepath.Join(stats.Name(), relPath))
+			relPath, _ := filepath.Rel(b.root, f)
+			part, err = writer.CreateFormFile("file", filepath.Join(b.stats.Name(), relPath))
 		}
 		if err != nil {
-			return contentType, err
+			return err
 		}
-		_, err = io.Copy(part, file)
+		err = writeFile(part, i)
 		if err != nil {
-			return contentType, err
+			return err
 		}
 	}
 
-	if groupId != "" {
-		err := writer.WriteField("group_id", groupId)
+	nameToUse := b.stats.Name()
+	if b.options.Name != "nil" {
+		nameToUse = b.options.Name
+	}
+	err = writeUploadFields(writer, b.options, nameToUse)
+	if err != nil {
+		return err
+	}
+
+	return writer.Close()
+}
+
+// writeUploadFields writes the form fields that follow the files of an upload
+func writeUploadFields(writer *multipart.Writer, options UploadOptions, name string) error {
+	if options.GroupId != "" {
+		err := writer.WriteField("group_id", options.GroupId)
 		if err != nil {
-			return contentType, err
+			return err
 		}
 	}
 
-	nameToUse := stats.Name()
-	if name != "nil" {
-		nameToUse = name
+	if len(options.KeyValues) > 0 {
+		keyvalues, err := json.Marshal(options.KeyValues)
+		if err != nil {
+			return err
+		}
+		err = writer.WriteField("keyvalues", string(keyvalues))
+		if err != nil {
+			return err
+		}
 	}
-	err := writer.WriteField("name", nameToUse)
+
+	return writer.WriteField("name", name)
+}
+
+// copyFile copies exactly the size recorded for the file, since the request
+// was sent with a Content-Length computed from it
+func (b *multipartBody) copyFile(part io.Writer, i int) error {
+	file, err := os.Open(b.files[i])
 	if err != nil {
-		return contentType, err
+		return err
 	}
+	defer file.Close()
 
-	err = writer.Close()
+	info, err := file.Stat()
 	if err != nil {
-		return contentType, err
+		return err
+	}
+	if info.Size() != b.sizes[i] {
+		return fmt.Errorf("%s changed while uploading", b.files[i])
+	}
+
+	var r io.Reader = file
+	if b.progress != nil {
+		r = &progressReader{r: file, progress: b.progress}
+	}
+	_, err = io.CopyN(part, r, b.sizes[i])
+	if err == io.EOF {
+		return fmt.Errorf("%s changed while uploading", b.files[i])
 	}
+	return err
+}
 
-	contentType = writer.FormDataContentType()
+type countingWriter struct {
+	n int64
+}
 
-	return contentType, nil
+func (c *countingWriter) Write(p []byte) (int, error) {
+	c.n += int64(len(p))
+	return len(p), nil
 }
 
-func pathsFinder(filePath string, stats os.FileInfo) ([]string, error) {
+// pathsFinder lists the files to upload for a path, applying filter to the
+// files of a folder
+func pathsFinder(filePath string, stats os.FileInfo, filter PathFilter) ([]string, error) {
 	var err error
 	files := make([]string, 0)
 	fileIsASingleFile := !stats.IsDir()
@@ -351,12 +682,23 @@ func pathsFinder(filePath string, stats os.FileInfo) ([]string, error) {
 		files = append(files, filePath)
 		return files, err
 	}
+	matcher := newPathMatcher(filter)
 	err = filepath.Walk(filePath,
 		func(path string, info os.FileInfo, err error) error {
 			if err != nil {
 				return err
 			}
-			if !info.IsDir() {
+			rel, err := filepath.Rel(filePath, path)
+			if err != nil {
+				return err
+			}
+			if info.IsDir() {
+				if rel != "." && matcher.skipDir(rel) {
+					return filepath.SkipDir
+				}
+				return matcher.enterDir(path, rel)
+			}
+			if matcher.includeFile(rel) {
 				files = append(files, path)
 			}
 			return nil
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"io"
+	"mime"
+	"mime/multipart"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestMultipartBodySize(t *testing.T) {
+	root := t.TempDir()
+	folder := filepath.Join(root, "site")
+	contents := map[string][]byte{
+		"index.html":         []byte("<h1>hi</h1>\n"),
+		"empty":              {},
+		"assets/data.bin":    testData(3*dagChunkSize + 17),
+		"assets/ünïcode.txt": []byte("names aren't only ASCII\n"),
+	}
+	for name, data := range contents {
+		path := filepath.Join(folder, name)
+		err := os.MkdirAll(filepath.Dir(path), 0755)
+		if err != nil {
+			t.Fatal(err)
+		}
+		err = os.WriteFile(path, data, 0644)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		options UploadOptions
+		parts   int
+	}{
+		{"file", filepath.Join(folder, "index.html"), UploadOptions{Name: "nil"}, 2},
+		{"empty file", filepath.Join(folder, "empty"), UploadOptions{Name: "nil"}, 2},
+		{"folder", folder, UploadOptions{Name: "nil"}, 5},
+		{
+			name: "folder with fields",
+			path: folder,
+			options: UploadOptions{
+				Name:      "my site",
+				GroupId:   "0190b5f1-7c8f-7b4c-b2d5-3f7a9d2c1e00",
+				KeyValues: map[string]string{"env": "prod", "commit": "abc123"},
+			},
+			parts: 7,
+		},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			stats, err := os.Stat(test.path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			files, err := pathsFinder(test.path, stats, test.options.Filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			body, err := newMultipartBody(test.path, files, stats, test.options)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			size, err := body.Size()
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader := body.Reader()
+			streamed, err := io.Copy(io.Discard, reader)
+			reader.Close()
+			if err != nil {
+				t.Fatal(err)
+			}
+			if size != streamed {
+				t.Errorf("Size() = %d, but %d bytes were streamed", size, streamed)
+			}
+
+			// The streamed form is complete and well formed
+			_, params, err := mime.ParseMediaType(body.ContentType())
+			if err != nil {
+				t.Fatal(err)
+			}
+			reader = body.Reader()
+			defer reader.Close()
+			form := multipart.NewReader(reader, params["boundary"])
+			var parts int
+			for {
+				part, err := form.NextPart()
+				if err == io.EOF {
+					break
+				}
+				if err != nil {
+					t.Fatal(err)
+				}
+				parts++
+				part.Close()
+			}
+			if parts != test.parts {
+				t.Errorf("got %d parts, want %d", parts, test.parts)
+			}
+		})
+	}
+}
@@ -0,0 +1,473 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchRetryDelay is how long a file that failed to upload waits before it's
+// tried again
+const watchRetryDelay = time.Minute
+
+type WatchOptions struct {
+	GroupId   string
+	KeyValues map[string]string
+	Filter    PathFilter
+	// Debounce is how long a file must stay unchanged before it's uploaded
+	Debounce time.Duration
+	// Poll scans the folder every PollInterval instead of relying on file
+	// notifications, which is also the fallback when they are unavailable
+	Poll         bool
+	PollInterval time.Duration
+	Concurrency  int
+	// StatePath overrides where the uploaded files are recorded
+	StatePath string
+}
+
+// WatchedFile is a file that was uploaded, recorded with the size and mtime
+// it had so it's only uploaded again when it changes
+type WatchedFile struct {
+	Size       int64  `json:"size"`
+	ModTime    int64  `json:"mod_time"`
+	Cid        string `json:"cid"`
+	Id         string `json:"id"`
+	UploadedAt string `json:"uploaded_at"`
+}
+
+type watchState struct {
+	Root    string                 `json:"root"`
+	GroupId string                 `json:"group_id,omitempty"`
+	Files   map[string]WatchedFile `json:"files"`
+}
+
+// pendingFile is a file waiting to stay unchanged for the debounce delay
+type pendingFile struct {
+	size    int64
+	modTime int64
+	since   time.Time
+}
+
+type folderWatcher struct {
+	root      string
+	options   WatchOptions
+	statePath string
+	queue     chan string
+
+	mu    sync.Mutex
+	state watchState
+	// pending files are keyed by their path relative to the root, queued
+	// holds the files waiting for or being uploaded
+	pending map[string]pendingFile
+	queued  map[string]bool
+}
+
+// WatchFolder uploads the files of a folder as they appear or change, once
+// they have stopped changing for the debounce delay. Uploaded files are
+// recorded in a state file so they aren't uploaded again after a restart.
+// It runs until it's interrupted.
+func WatchFolder(root string, options WatchOptions) error {
+	stats, err := os.Stat(root)
+	if err != nil {
+		return err
+	}
+	if !stats.IsDir() {
+		return fmt.Errorf("%s is not a folder", root)
+	}
+	if options.Debounce <= 0 {
+		options.Debounce = 2 * time.Second
+	}
+	if options.PollInterval <= 0 {
+		options.PollInterval = 5 * time.Second
+	}
+	if options.Concurrency < 1 {
+		options.Concurrency = 1
+	}
+
+	statePath := options.StatePath
+	if statePath == "" {
+		statePath, err = watchStatePath(root, options.GroupId)
+		if err != nil {
+			return err
+		}
+	}
+	state, err := loadWatchState(statePath)
+	if err != nil {
+		return err
+	}
+	state.Root, _ = filepath.Abs(root)
+	state.GroupId = options.GroupId
+
+	w := &folderWatcher{
+		root:      root,
+		options:   options,
+		statePath: statePath,
+		queue:     make(chan string),
+		state:     state,
+		pending:   map[string]pendingFile{},
+		queued:    map[string]bool{},
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var notifications *fsnotify.Watcher
+	if !options.Poll {
+		notifications, err = fsnotify.NewWatcher()
+		if err == nil {
+			defer notifications.Close()
+			err = w.watchDirs(notifications, root)
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "File notifications are unavailable (%s), polling every %s instead\n", err, options.PollInterval)
+			options.Poll = true
+		}
+	}
+	var events chan fsnotify.Event
+	var errs chan error
+	if !options.Poll {
+		events = notifications.Events
+		errs = notifications.Errors
+	}
+
+	for i := 0; i < options.Concurrency; i++ {
+		go func() {
+			for rel := range w.queue {
+				w.upload(rel)
+			}
+		}()
+	}
+
+	mode := "file notifications"
+	if options.Poll {
+		mode = fmt.Sprintf("polling every %s", options.PollInterval)
+	}
+	fmt.Fprintf(os.Stderr, "Watching %s with %s, %d files already uploaded\n", root, mode, len(state.Files))
+	err = w.scan()
+	if err != nil {
+		return err
+	}
+
+	// Pending files are checked a few times per debounce period, but not more
+	// often than every millisecond
+	interval := options.Debounce / 4
+	if interval < time.Millisecond {
+		interval = time.Millisecond
+	}
+	debounce := time.NewTicker(interval)
+	defer debounce.Stop()
+	var poll <-chan time.Time
+	if options.Poll {
+		ticker := time.NewTicker(options.PollInterval)
+		defer ticker.Stop()
+		poll = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			fmt.Fprintln(os.Stderr, "Stopped watching", root)
+			return nil
+		case event := <-events:
+			w.handleEvent(notifications, event)
+		case err := <-errs:
+			fmt.Fprintf(os.Stderr, "File notification error: %s\n", err)
+			if errors.Is(err, fsnotify.ErrEventOverflow) {
+				w.logScan()
+			}
+		case <-poll:
+			w.logScan()
+		case <-debounce.C:
+			w.checkPending()
+		}
+	}
+}
+
+// watchStatePath names the state file after the folder, profile and group so
+// each combination keeps its own record
+func watchStatePath(root string, groupId string) (string, error) {
+	dir, err := configDir()
+	if err != nil {
+		return "", err
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return "", err
+	}
+	config, err := loadConfig()
+	if err != nil {
+		return "", err
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s\n%s\n%s\n", absRoot, config.ActiveProfileName(), groupId)
+	return filepath.Join(dir, "watch", hex.EncodeToString(h.Sum(nil))[:16]+".json"), nil
+}
+
+func loadWatchState(p string) (watchState, error) {
+	state := watchState{Files: map[string]WatchedFile{}}
+	data, err := os.ReadFile(p)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return state, nil
+		}
+		return state, err
+	}
+	err = json.Unmarshal(data, &state)
+	if err != nil {
+		return state, errors.Join(err, errors.New("failed to parse watch state file "+p))
+	}
+	if state.Files == nil {
+		state.Files = map[string]WatchedFile{}
+	}
+	return state, nil
+}
+
+// saveState writes the state file, w.mu must be held
+func (w *folderWatcher) saveState() error {
+	err := os.MkdirAll(filepath.Dir(w.statePath), 0700)
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(w.state, "", "    ")
+	if err != nil {
+		return err
+	}
+	tmpPath := w.statePath + ".tmp"
+	err = os.WriteFile(tmpPath, data, 0600)
+	if err != nil {
+		return err
+	}
+	return os.Rename(tmpPath, w.statePath)
+}
+
+// watchDirs adds dir and the folders below it that aren't filtered out to
+// the notifications, which aren't recursive
+func (w *folderWatcher) watchDirs(notifications *fsnotify.Watcher, dir string) error {
+	return filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(w.root, path)
+		if err != nil {
+			return err
+		}
+		if rel != "." {
+			m, err := matcherAt(w.root, rel, w.options.Filter)
+			if err != nil {
+				return err
+			}
+			if m == nil {
+				return filepath.SkipDir
+			}
+		}
+		return notifications.Add(path)
+	})
+}
+
+func (w *folderWatcher) handleEvent(notifications *fsnotify.Watcher, event fsnotify.Event) {
+	if !event.Has(fsnotify.Create) && !event.Has(fsnotify.Write) {
+		return
+	}
+	info, err := os.Stat(event.Name)
+	if err != nil {
+		return
+	}
+	if info.IsDir() {
+		// Files may have been created before the folder was watched
+		err = w.watchDirs(notifications, event.Name)
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "Failed to watch %s: %s\n", event.Name, err)
+		}
+		w.logScan()
+		return
+	}
+	rel, err := filepath.Rel(w.root, event.Name)
+	if err != nil {
+		return
+	}
+	matches, err := filterMatches(w.root, rel, w.options.Filter)
+	if err != nil || !matches {
+		return
+	}
+	w.touch(rel, info)
+}
+
+func (w *folderWatcher) logScan() {
+	err := w.scan()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to scan %s: %s\n", w.root, err)
+	}
+}
+
+// scan looks for files that weren't uploaded or changed since
+func (w *folderWatcher) scan() error {
+	stats, err := os.Stat(w.root)
+	if err != nil {
+		return err
+	}
+	files, err := pathsFinder(w.root, stats, w.options.Filter)
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		info, err := os.Stat(f)
+		if err != nil {
+			continue
+		}
+		rel, err := filepath.Rel(w.root, f)
+		if err != nil {
+			continue
+		}
+		w.mu.Lock()
+		_, isPending := w.pending[rel]
+		uploaded, ok := w.state.Files[rel]
+		w.mu.Unlock()
+		if isPending || ok && uploaded.Size == info.Size() && uploaded.ModTime == info.ModTime().UnixNano() {
+			continue
+		}
+		w.touch(rel, info)
+	}
+	return nil
+}
+
+// touch marks a file as changed, restarting its debounce delay
+func (w *folderWatcher) touch(rel string, info os.FileInfo) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	if w.queued[rel] {
+		return
+	}
+	w.pending[rel] = pendingFile{size: info.Size(), modTime: info.ModTime().UnixNano(), since: time.Now()}
+}
+
+// checkPending queues the files that haven't changed for the debounce delay
+func (w *folderWatcher) checkPending() {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	for rel, p := range w.pending {
+		info, err := os.Stat(filepath.Join(w.root, rel))
+		if err != nil {
+			delete(w.pending, rel)
+			continue
+		}
+		if info.Size() != p.size || info.ModTime().UnixNano() != p.modTime {
+			w.pending[rel] = pendingFile{size: info.Size(), modTime: info.ModTime().UnixNano(), since: time.Now()}
+			continue
+		}
+		if time.Since(p.since) < w.options.Debounce {
+			continue
+		}
+		delete(w.pending, rel)
+		// Ignore files may have changed since the file was seen
+		matches, err := filterMatches(w.root, rel, w.options.Filter)
+		if err != nil || !matches {
+			continue
+		}
+		w.queued[rel] = true
+		go func(rel string) {
+			w.queue <- rel
+		}(rel)
+	}
+}
+
+// upload uploads a stable file unless its content was already uploaded, and
+// records it. Files that change during the upload are checked again.
+func (w *folderWatcher) upload(rel string) {
+	path := filepath.Join(w.root, rel)
+	name := filepath.ToSlash(rel)
+	defer func() {
+		w.mu.Lock()
+		defer w.mu.Unlock()
+		delete(w.queued, rel)
+		if _, retrying := w.pending[rel]; retrying {
+			return
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return
+		}
+		uploaded, ok := w.state.Files[rel]
+		if !ok || uploaded.Size != info.Size() || uploaded.ModTime != info.ModTime().UnixNano() {
+			w.pending[rel] = pendingFile{size: info.Size(), modTime: info.ModTime().UnixNano(), since: time.Now()}
+		}
+	}()
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return
+	}
+	record := WatchedFile{Size: info.Size(), ModTime: info.ModTime().UnixNano()}
+	local, err := pathCID(path, PathFilter{})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to read %s, retrying in %s: %s\n", name, watchRetryDelay, err)
+		w.retryLater(rel, record)
+		return
+	}
+	record.Cid = local.Cid
+
+	w.mu.Lock()
+	previous, ok := w.state.Files[rel]
+	w.mu.Unlock()
+	if ok && previous.Cid == local.Cid {
+		// Only the mtime changed
+		record.Id = previous.Id
+		record.UploadedAt = previous.UploadedAt
+		w.record(rel, record)
+		return
+	}
+
+	response, err := Upload(path, UploadOptions{
+		GroupId:   w.options.GroupId,
+		Name:      name,
+		KeyValues: w.options.KeyValues,
+	})
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to upload %s, retrying in %s: %s\n", name, watchRetryDelay, err)
+		w.retryLater(rel, record)
+		return
+	}
+
+	record.Id = response.Data.Id
+	record.Cid = response.Data.Cid
+	record.UploadedAt = time.Now().UTC().Format(time.RFC3339)
+	w.record(rel, record)
+
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	fmt.Fprintf(os.Stderr, "Uploaded %s as %s\n", name, response.Data.Id)
+	err = render(response.Data, response.Data)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+	}
+}
+
+// retryLater puts a file back in the pending files after watchRetryDelay
+func (w *folderWatcher) retryLater(rel string, file WatchedFile) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.pending[rel] = pendingFile{size: file.Size, modTime: file.ModTime, since: time.Now().Add(watchRetryDelay)}
+}
+
+func (w *folderWatcher) record(rel string, file WatchedFile) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.state.Files[rel] = file
+	err := w.saveState()
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Failed to save watch state %s: %s\n", w.statePath, err)
+	}
+}